@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/rke2-security-responder/telemetry"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// envTagPrefix marks environment variables that add a static tag.
+const envTagPrefix = "SECURITY_RESPONDER_TAG_"
+
+// Config holds every responder setting. Values are resolved in increasing
+// precedence from the defaults, the YAML file named by
+// SECURITY_RESPONDER_CONFIG_FILE, the SECURITY_RESPONDER_* environment
+// variables, and the command-line flags. Field names match the YAML keys.
+type Config struct {
+	Mode             string   `json:"mode"`
+	Endpoints        []string `json:"endpoints"`
+	AllowInsecure    bool     `json:"allowInsecure"`
+	RequireAll       bool     `json:"requireAll"`
+	DisableTelemetry bool     `json:"disableTelemetry"`
+	DryRun           bool     `json:"dryRun"`
+	SelfTest         bool     `json:"selfTest"`
+	Dev              bool     `json:"dev"`
+	Kubeconfig       string   `json:"kubeconfig"`
+
+	CollectionTimeout      metav1.Duration   `json:"collectionTimeout"`
+	RunInterval            metav1.Duration   `json:"runInterval"`
+	MaxRunInterval         metav1.Duration   `json:"maxRunInterval"`
+	StartupJitter          metav1.Duration   `json:"startupJitter"`
+	VersionRefreshInterval int               `json:"versionRefreshInterval"`
+	BestEffort             bool              `json:"bestEffort"`
+	DisableDetectors       []string          `json:"disableDetectors"`
+	NodeSelector           string            `json:"nodeSelector"`
+	HashNodeNames          bool              `json:"hashNodeNames"`
+	CNINamespaces          []string          `json:"cniNamespaces"`
+	TopNamespaces          int               `json:"topNamespaces"`
+	IncludeRuntimeStats    bool              `json:"includeRuntimeStats"`
+	HashClusterUUID        bool              `json:"hashClusterUUID"`
+	ClusterUUIDSalt        string            `json:"clusterUUIDSalt"`
+	Fields                 []string          `json:"fields"`
+	FieldNameMap           map[string]string `json:"fieldNameMap"`
+	Tags                   map[string]string `json:"tags"`
+	SchemaVersion          string            `json:"schemaVersion"`
+	OutputFile             string            `json:"outputFile"`
+	OutputDir              string            `json:"outputDir"`
+	OutputKeep             int               `json:"outputKeep"`
+	OutputMode             string            `json:"outputMode"`
+
+	Format        string          `json:"format"`
+	Method        string          `json:"method"`
+	Compress      bool            `json:"compress"`
+	MaxRetries    int             `json:"maxRetries"`
+	RetryDelay    metav1.Duration `json:"retryDelay"`
+	MaxRetryDelay metav1.Duration `json:"maxRetryDelay"`
+	// The circuit breaker applies in periodic mode; a threshold of 0
+	// disables it.
+	CircuitBreakerThreshold int             `json:"circuitBreakerThreshold"`
+	CircuitBreakerCooldown  metav1.Duration `json:"circuitBreakerCooldown"`
+	// Sends closer together than minReportInterval are skipped, as are
+	// unchanged payloads younger than maxReportAge with sendOnChange. The
+	// last send survives restarts when stateFile is set.
+	MinReportInterval metav1.Duration `json:"minReportInterval"`
+	SendOnChange      bool            `json:"sendOnChange"`
+	MaxReportAge      metav1.Duration `json:"maxReportAge"`
+	StateFile         string          `json:"stateFile"`
+
+	// Secrets are best mounted from a Secret through the *File settings.
+	// They are never logged.
+	AuthToken     string `json:"authToken"`
+	AuthTokenFile string `json:"authTokenFile"`
+	HMACKey       string `json:"hmacKey"`
+	HMACKeyFile   string `json:"hmacKeyFile"`
+
+	Proxy              string          `json:"proxy"`
+	CACert             string          `json:"caCert"`
+	InsecureSkipVerify bool            `json:"insecureSkipVerify"`
+	ClientCert         string          `json:"clientCert"`
+	ClientKey          string          `json:"clientKey"`
+	ConnectTimeout     metav1.Duration `json:"connectTimeout"`
+	TotalTimeout       metav1.Duration `json:"totalTimeout"`
+
+	MetricsAddr string `json:"metricsAddr"`
+	HealthAddr  string `json:"healthAddr"`
+	LogLevel    string `json:"logLevel"`
+	LogFormat   string `json:"logFormat"`
+	LogOutput   string `json:"logOutput"`
+}
+
+// defaultConfig returns the settings used when neither the file nor the
+// environment sets a value.
+func defaultConfig() *Config {
+	send := telemetry.DefaultSendOptions()
+	return &Config{
+		Mode:                   "recommended",
+		Endpoints:              []string{telemetry.DefaultEndpoint},
+		CollectionTimeout:      metav1.Duration{Duration: defaultCollectionTimeout},
+		VersionRefreshInterval: 1,
+		TopNamespaces:          defaultTopNamespaces,
+		OutputKeep:             defaultOutputKeep,
+		OutputMode:             outputModeBoth,
+		Format:                 telemetry.FormatJSON,
+		Method:                 http.MethodPost,
+		MaxRetries:             send.MaxRetries,
+		RetryDelay:             metav1.Duration{Duration: send.RetryDelay},
+		MaxRetryDelay:          metav1.Duration{Duration: send.MaxRetryDelay},
+		CircuitBreakerCooldown: metav1.Duration{Duration: defaultCircuitBreakerCooldown},
+		MinReportInterval:      metav1.Duration{Duration: defaultMinReportInterval},
+		MaxReportAge:           metav1.Duration{Duration: defaultMaxReportAge},
+		LogLevel:               "info",
+		LogFormat:              "text",
+		LogOutput:              logOutputStderr,
+	}
+}
+
+// loadConfig resolves the configuration from the defaults, the config file,
+// the environment, and the flags in fs, then validates it and reads any
+// secret files.
+func loadConfig(fs *flag.FlagSet) (*Config, error) {
+	cfg := defaultConfig()
+	if path := flagOrEnv(fs, "config", "SECURITY_RESPONDER_CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(fs); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the YAML file at path. Unknown keys are rejected so a
+// misspelt setting is not silently ignored.
+func (c *Config) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(raw, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	logrus.WithField("path", path).Debug("loaded config file")
+	return nil
+}
+
+// applyEnv overlays the settings given in the environment, and then those
+// given as flags in fs. Unset variables keep the current value.
+func (c *Config) applyEnv(fs *flag.FlagSet) error {
+	str := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	boolean := func(dst *bool, v string) {
+		if v != "" {
+			*dst = v == "true"
+		}
+	}
+	list := func(dst *[]string, v string) {
+		if values := splitList(v); values != nil {
+			*dst = values
+		}
+	}
+	env := os.Getenv
+
+	str(&c.Mode, env("SECURITY_RESPONDER_MODE"))
+	list(&c.Endpoints, flagOrEnv(fs, "endpoint", "SECURITY_RESPONDER_ENDPOINT"))
+	boolean(&c.AllowInsecure, env("SECURITY_RESPONDER_ALLOW_INSECURE"))
+	boolean(&c.RequireAll, env("SECURITY_RESPONDER_REQUIRE_ALL"))
+	boolean(&c.DisableTelemetry, flagOrEnv(fs, "disable-telemetry", "SECURITY_RESPONDER_DISABLE_TELEMETRY"))
+	boolean(&c.DryRun, flagOrEnv(fs, "dry-run", "SECURITY_RESPONDER_DRY_RUN"))
+	boolean(&c.SelfTest, flagOrEnv(fs, "self-test", "SECURITY_RESPONDER_SELF_TEST"))
+	boolean(&c.Dev, env("SECURITY_RESPONDER_DEV"))
+	str(&c.Kubeconfig, flagOrEnv(fs, "kubeconfig", "KUBECONFIG"))
+
+	boolean(&c.BestEffort, env("SECURITY_RESPONDER_BEST_EFFORT"))
+	list(&c.DisableDetectors, env("SECURITY_RESPONDER_DISABLE_DETECTORS"))
+	str(&c.NodeSelector, env("SECURITY_RESPONDER_NODE_SELECTOR"))
+	boolean(&c.HashNodeNames, env("SECURITY_RESPONDER_HASH_NODE_NAMES"))
+	list(&c.CNINamespaces, env("SECURITY_RESPONDER_CNI_NAMESPACES"))
+	boolean(&c.IncludeRuntimeStats, env("SECURITY_RESPONDER_INCLUDE_RUNTIME_STATS"))
+	boolean(&c.HashClusterUUID, env("SECURITY_RESPONDER_HASH_CLUSTER_UUID"))
+	str(&c.ClusterUUIDSalt, env("SECURITY_RESPONDER_CLUSTER_UUID_SALT"))
+	list(&c.Fields, env("SECURITY_RESPONDER_FIELDS"))
+	str(&c.SchemaVersion, env("SECURITY_RESPONDER_SCHEMA_VERSION"))
+	c.applyEnvTags()
+	str(&c.OutputFile, env("SECURITY_RESPONDER_OUTPUT_FILE"))
+	str(&c.OutputDir, env("SECURITY_RESPONDER_OUTPUT_DIR"))
+	str(&c.OutputMode, env("SECURITY_RESPONDER_OUTPUT_MODE"))
+
+	str(&c.Format, env("SECURITY_RESPONDER_FORMAT"))
+	str(&c.Method, env("SECURITY_RESPONDER_METHOD"))
+	boolean(&c.Compress, env("SECURITY_RESPONDER_COMPRESS"))
+	str(&c.AuthToken, env("SECURITY_RESPONDER_AUTH_TOKEN"))
+	str(&c.AuthTokenFile, env("SECURITY_RESPONDER_AUTH_TOKEN_FILE"))
+	str(&c.HMACKey, env("SECURITY_RESPONDER_HMAC_KEY"))
+	str(&c.HMACKeyFile, env("SECURITY_RESPONDER_HMAC_KEY_FILE"))
+	boolean(&c.SendOnChange, env("SECURITY_RESPONDER_SEND_ON_CHANGE"))
+	str(&c.StateFile, env("SECURITY_RESPONDER_STATE_FILE"))
+
+	str(&c.Proxy, env("SECURITY_RESPONDER_PROXY"))
+	str(&c.CACert, env("SECURITY_RESPONDER_CA_CERT"))
+	boolean(&c.InsecureSkipVerify, env("SECURITY_RESPONDER_INSECURE_SKIP_VERIFY"))
+	str(&c.ClientCert, env("SECURITY_RESPONDER_CLIENT_CERT"))
+	str(&c.ClientKey, env("SECURITY_RESPONDER_CLIENT_KEY"))
+
+	str(&c.MetricsAddr, env("SECURITY_RESPONDER_METRICS_ADDR"))
+	str(&c.HealthAddr, env("SECURITY_RESPONDER_HEALTH_ADDR"))
+	str(&c.LogLevel, env("SECURITY_RESPONDER_LOG_LEVEL"))
+	str(&c.LogFormat, env("SECURITY_RESPONDER_LOG_FORMAT"))
+	str(&c.LogOutput, env("SECURITY_RESPONDER_LOG_OUTPUT"))
+
+	if v := env("SECURITY_RESPONDER_FIELD_NAME_MAP"); v != "" {
+		var names map[string]string
+		if err := json.Unmarshal([]byte(v), &names); err != nil {
+			return fmt.Errorf("invalid SECURITY_RESPONDER_FIELD_NAME_MAP: %w", err)
+		}
+		c.FieldNameMap = names
+	}
+
+	var err error
+	if c.VersionRefreshInterval, err = envInt("SECURITY_RESPONDER_VERSION_REFRESH_INTERVAL", c.VersionRefreshInterval); err != nil {
+		return err
+	}
+	if c.MaxRetries, err = envInt("SECURITY_RESPONDER_MAX_RETRIES", c.MaxRetries); err != nil {
+		return err
+	}
+	if c.OutputKeep, err = envInt("SECURITY_RESPONDER_OUTPUT_KEEP", c.OutputKeep); err != nil {
+		return err
+	}
+	if c.TopNamespaces, err = envInt("SECURITY_RESPONDER_TOP_NAMESPACES", c.TopNamespaces); err != nil {
+		return err
+	}
+	if c.CircuitBreakerThreshold, err = envInt("SECURITY_RESPONDER_CIRCUIT_BREAKER_THRESHOLD", c.CircuitBreakerThreshold); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		dst *time.Duration
+		env string
+		v   string
+	}{
+		{&c.CollectionTimeout.Duration, "SECURITY_RESPONDER_COLLECTION_TIMEOUT", flagOrEnv(fs, "timeout", "SECURITY_RESPONDER_COLLECTION_TIMEOUT")},
+		{&c.RunInterval.Duration, "SECURITY_RESPONDER_RUN_INTERVAL", env("SECURITY_RESPONDER_RUN_INTERVAL")},
+		{&c.MaxRunInterval.Duration, "SECURITY_RESPONDER_MAX_RUN_INTERVAL", env("SECURITY_RESPONDER_MAX_RUN_INTERVAL")},
+		{&c.StartupJitter.Duration, "SECURITY_RESPONDER_STARTUP_JITTER", env("SECURITY_RESPONDER_STARTUP_JITTER")},
+		{&c.RetryDelay.Duration, "SECURITY_RESPONDER_RETRY_DELAY", env("SECURITY_RESPONDER_RETRY_DELAY")},
+		{&c.MaxRetryDelay.Duration, "SECURITY_RESPONDER_MAX_RETRY_DELAY", env("SECURITY_RESPONDER_MAX_RETRY_DELAY")},
+		{&c.CircuitBreakerCooldown.Duration, "SECURITY_RESPONDER_CIRCUIT_BREAKER_COOLDOWN", env("SECURITY_RESPONDER_CIRCUIT_BREAKER_COOLDOWN")},
+		{&c.MinReportInterval.Duration, "SECURITY_RESPONDER_MIN_REPORT_INTERVAL", env("SECURITY_RESPONDER_MIN_REPORT_INTERVAL")},
+		{&c.MaxReportAge.Duration, "SECURITY_RESPONDER_MAX_REPORT_AGE", env("SECURITY_RESPONDER_MAX_REPORT_AGE")},
+		{&c.ConnectTimeout.Duration, "SECURITY_RESPONDER_CONNECT_TIMEOUT", env("SECURITY_RESPONDER_CONNECT_TIMEOUT")},
+		{&c.TotalTimeout.Duration, "SECURITY_RESPONDER_TOTAL_TIMEOUT", env("SECURITY_RESPONDER_TOTAL_TIMEOUT")},
+	}
+	for _, d := range durations {
+		if *d.dst, err = parseDuration(d.env, d.v, *d.dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnvTags adds a static tag for each SECURITY_RESPONDER_TAG_<NAME>
+// variable, keyed by the lowercased NAME. Variables override file tags of
+// the same name.
+func (c *Config) applyEnvTags() {
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		key, ok := strings.CutPrefix(name, envTagPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if c.Tags == nil {
+			c.Tags = make(map[string]string)
+		}
+		c.Tags[strings.ToLower(key)] = value
+	}
+}
+
+// validate checks the resolved configuration. Errors name the config file
+// key; the README maps each key to its environment variable.
+func (c *Config) validate() error {
+	switch c.Mode {
+	case "recommended", "minimal":
+	default:
+		return fmt.Errorf("invalid mode %q: must be recommended or minimal", c.Mode)
+	}
+	if len(c.Endpoints) == 0 {
+		return fmt.Errorf("endpoints must not be empty")
+	}
+	for _, endpoint := range c.Endpoints {
+		if err := telemetry.ValidateEndpoint(endpoint, c.AllowInsecure); err != nil {
+			return err
+		}
+	}
+
+	switch c.Format {
+	case "", telemetry.FormatJSON, telemetry.FormatOTLP, telemetry.FormatRemoteWrite, telemetry.FormatGRPC:
+	default:
+		return fmt.Errorf("invalid format %q: must be %q, %q, %q, or %q",
+			c.Format, telemetry.FormatJSON, telemetry.FormatOTLP, telemetry.FormatRemoteWrite, telemetry.FormatGRPC)
+	}
+	switch c.Method {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("invalid method %q: must be %s or %s", c.Method, http.MethodPost, http.MethodPut)
+	}
+	switch c.OutputMode {
+	case outputModeBoth, outputModeFile:
+	default:
+		return fmt.Errorf("invalid outputMode %q: must be %q or %q", c.OutputMode, outputModeBoth, outputModeFile)
+	}
+	if c.OutputKeep < 1 {
+		return fmt.Errorf("invalid outputKeep %d: must be at least 1", c.OutputKeep)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("maxRetries must not be negative, got %d", c.MaxRetries)
+	}
+	if c.TopNamespaces < 0 {
+		return fmt.Errorf("topNamespaces must not be negative, got %d", c.TopNamespaces)
+	}
+	if c.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("circuitBreakerThreshold must not be negative, got %d", c.CircuitBreakerThreshold)
+	}
+	if c.VersionRefreshInterval < 1 {
+		return fmt.Errorf("invalid versionRefreshInterval %d: must be at least 1", c.VersionRefreshInterval)
+	}
+	detectors := make(map[string]bool)
+	for _, d := range telemetry.DefaultDetectors() {
+		detectors[d.Name()] = true
+	}
+	for _, name := range c.DisableDetectors {
+		if !detectors[name] {
+			return fmt.Errorf("invalid disableDetectors entry %q: unknown detector", name)
+		}
+	}
+	for key := range c.Tags {
+		if key == "" {
+			return fmt.Errorf("tags must not have an empty name")
+		}
+	}
+	renamedFrom := make(map[string]string, len(c.FieldNameMap))
+	for from, to := range c.FieldNameMap {
+		if from == "" || to == "" {
+			return fmt.Errorf("fieldNameMap must not have an empty name")
+		}
+		if other, ok := renamedFrom[to]; ok {
+			return fmt.Errorf("invalid fieldNameMap: %q and %q are both renamed to %q", other, from, to)
+		}
+		renamedFrom[to] = from
+	}
+	if _, err := labels.Parse(c.NodeSelector); err != nil {
+		return fmt.Errorf("invalid nodeSelector %q: %w", c.NodeSelector, err)
+	}
+
+	// Durations from the environment are checked when parsed; these may
+	// also come from the file.
+	durations := map[string]time.Duration{
+		"collectionTimeout":      c.CollectionTimeout.Duration,
+		"runInterval":            c.RunInterval.Duration,
+		"maxRunInterval":         c.MaxRunInterval.Duration,
+		"startupJitter":          c.StartupJitter.Duration,
+		"retryDelay":             c.RetryDelay.Duration,
+		"maxRetryDelay":          c.MaxRetryDelay.Duration,
+		"circuitBreakerCooldown": c.CircuitBreakerCooldown.Duration,
+		"minReportInterval":      c.MinReportInterval.Duration,
+		"maxReportAge":           c.MaxReportAge.Duration,
+		"connectTimeout":         c.ConnectTimeout.Duration,
+		"totalTimeout":           c.TotalTimeout.Duration,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			return fmt.Errorf("invalid %s %v: must not be negative", name, d)
+		}
+	}
+
+	if c.MaxRunInterval.Duration != 0 && c.MaxRunInterval.Duration < c.RunInterval.Duration {
+		return fmt.Errorf("invalid maxRunInterval %v: must not be shorter than runInterval %v", c.MaxRunInterval.Duration, c.RunInterval.Duration)
+	}
+
+	if c.CircuitBreakerThreshold > 0 && c.CircuitBreakerCooldown.Duration == 0 {
+		return fmt.Errorf("circuitBreakerCooldown must be set when circuitBreakerThreshold is")
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid logLevel %q: %w", c.LogLevel, err)
+	}
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("invalid logFormat %q: must be text or json", c.LogFormat)
+	}
+	return nil
+}
+
+// maxRunInterval returns the longest delay between periodic cycles while
+// every endpoint is failing, by default four times the run interval.
+func (c *Config) maxRunInterval() time.Duration {
+	if c.MaxRunInterval.Duration > 0 {
+		return c.MaxRunInterval.Duration
+	}
+	return 4 * c.RunInterval.Duration
+}
+
+// loadSecrets replaces the inline secrets with the contents of their files,
+// when set.
+func (c *Config) loadSecrets() error {
+	var err error
+	if c.AuthToken, err = loadSecret("authTokenFile", c.AuthToken, c.AuthTokenFile); err != nil {
+		return err
+	}
+	if c.HMACKey, err = loadSecret("hmacKeyFile", c.HMACKey, c.HMACKeyFile); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfigFile(t, `
+mode: minimal
+endpoints:
+  - https://file.example.com
+maxRetries: 5
+collectionTimeout: 90s
+tags:
+  environment: staging
+  team: platform
+dryRun: true
+authTokenFile: `+tokenFile+`
+`)
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		verify func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			verify: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, defaultConfig()) {
+					t.Errorf("loadConfig() = %+v, want defaults %+v", cfg, defaultConfig())
+				}
+			},
+		},
+		{
+			name: "file overrides defaults",
+			env:  map[string]string{"SECURITY_RESPONDER_CONFIG_FILE": path},
+			verify: func(t *testing.T, cfg *Config) {
+				if cfg.Mode != "minimal" || cfg.MaxRetries != 5 || !cfg.DryRun {
+					t.Errorf("mode = %q, maxRetries = %d, dryRun = %v; want file values", cfg.Mode, cfg.MaxRetries, cfg.DryRun)
+				}
+				if cfg.CollectionTimeout.Duration != 90*time.Second {
+					t.Errorf("collectionTimeout = %v, want 90s", cfg.CollectionTimeout.Duration)
+				}
+				if !reflect.DeepEqual(cfg.Endpoints, []string{"https://file.example.com"}) {
+					t.Errorf("endpoints = %v, want file endpoint", cfg.Endpoints)
+				}
+				if cfg.AuthToken != "from-file" {
+					t.Errorf("authToken = %q, want token file contents", cfg.AuthToken)
+				}
+				// Unset keys keep their defaults.
+				if cfg.LogFormat != "text" || cfg.OutputMode != outputModeBoth {
+					t.Errorf("logFormat = %q, outputMode = %q; want defaults", cfg.LogFormat, cfg.OutputMode)
+				}
+			},
+		},
+		{
+			name: "env overrides file",
+			env: map[string]string{
+				"SECURITY_RESPONDER_CONFIG_FILE":        path,
+				"SECURITY_RESPONDER_MODE":               "recommended",
+				"SECURITY_RESPONDER_MAX_RETRIES":        "1",
+				"SECURITY_RESPONDER_DRY_RUN":            "false",
+				"SECURITY_RESPONDER_ENDPOINT":           "https://env.example.com",
+				"SECURITY_RESPONDER_COLLECTION_TIMEOUT": "10s",
+				"SECURITY_RESPONDER_TAG_ENVIRONMENT":    "prod",
+				"SECURITY_RESPONDER_TAG_Region":         "eu-west",
+				"SECURITY_RESPONDER_FIELD_NAME_MAP":     `{"serverNodeCount":"server_node_count"}`,
+			},
+			verify: func(t *testing.T, cfg *Config) {
+				if want := map[string]string{"serverNodeCount": "server_node_count"}; !reflect.DeepEqual(cfg.FieldNameMap, want) {
+					t.Errorf("fieldNameMap = %v, want %v", cfg.FieldNameMap, want)
+				}
+				if want := map[string]string{"environment": "prod", "region": "eu-west", "team": "platform"}; !reflect.DeepEqual(cfg.Tags, want) {
+					t.Errorf("tags = %v, want %v", cfg.Tags, want)
+				}
+				if cfg.Mode != "recommended" || cfg.MaxRetries != 1 || cfg.DryRun {
+					t.Errorf("mode = %q, maxRetries = %d, dryRun = %v; want env values", cfg.Mode, cfg.MaxRetries, cfg.DryRun)
+				}
+				if cfg.CollectionTimeout.Duration != 10*time.Second {
+					t.Errorf("collectionTimeout = %v, want 10s", cfg.CollectionTimeout.Duration)
+				}
+				if !reflect.DeepEqual(cfg.Endpoints, []string{"https://env.example.com"}) {
+					t.Errorf("endpoints = %v, want env endpoint", cfg.Endpoints)
+				}
+			},
+		},
+		{
+			name: "flags override env",
+			args: []string{"--config=" + path, "--endpoint=https://flag.example.com", "--timeout=5s"},
+			env: map[string]string{
+				"SECURITY_RESPONDER_ENDPOINT":           "https://env.example.com",
+				"SECURITY_RESPONDER_COLLECTION_TIMEOUT": "10s",
+			},
+			verify: func(t *testing.T, cfg *Config) {
+				if cfg.Mode != "minimal" {
+					t.Errorf("mode = %q, want minimal from --config file", cfg.Mode)
+				}
+				if cfg.CollectionTimeout.Duration != 5*time.Second {
+					t.Errorf("collectionTimeout = %v, want 5s", cfg.CollectionTimeout.Duration)
+				}
+				if !reflect.DeepEqual(cfg.Endpoints, []string{"https://flag.example.com"}) {
+					t.Errorf("endpoints = %v, want flag endpoint", cfg.Endpoints)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("config", "", "")
+			fs.String("endpoint", "", "")
+			fs.Duration("timeout", defaultCollectionTimeout, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			cfg, err := loadConfig(fs)
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			tt.verify(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{"unknown key", "endpiont: https://example.com\n", nil},
+		{"malformed yaml", "mode: [minimal\n", nil},
+		{"bad duration", "retryDelay: soon\n", nil},
+		{"invalid file value", "format: xml\n", nil},
+		{"invalid env value", "", map[string]string{"SECURITY_RESPONDER_MAX_RETRIES": "many"}},
+		{"invalid field name map", "", map[string]string{"SECURITY_RESPONDER_FIELD_NAME_MAP": "os=x"}},
+		{"missing secret file", "hmacKeyFile: /nonexistent/key\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SECURITY_RESPONDER_CONFIG_FILE", writeConfigFile(t, tt.file))
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError)); err == nil {
+				t.Error("loadConfig() expected error")
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("SECURITY_RESPONDER_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		if _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError)); err == nil {
+			t.Error("loadConfig() expected error")
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(c *Config) {}, false},
+		{"minimal otlp", func(c *Config) { c.Mode = "minimal"; c.Format = "otlp" }, false},
+		{"grpc format", func(c *Config) { c.Format = "grpc" }, false},
+		{"invalid mode", func(c *Config) { c.Mode = "full" }, true},
+		{"no endpoints", func(c *Config) { c.Endpoints = nil }, true},
+		{"http endpoint", func(c *Config) { c.Endpoints = []string{"http://example.com"} }, true},
+		{"http endpoint allowed", func(c *Config) {
+			c.Endpoints = []string{"http://example.com"}
+			c.AllowInsecure = true
+		}, false},
+		{"invalid format", func(c *Config) { c.Format = "xml" }, true},
+		{"put method", func(c *Config) { c.Method = "PUT" }, false},
+		{"invalid method", func(c *Config) { c.Method = "PATCH" }, true},
+		{"invalid output mode", func(c *Config) { c.OutputMode = "stdout" }, true},
+		{"negative retries", func(c *Config) { c.MaxRetries = -1 }, true},
+		{"top namespaces disabled", func(c *Config) { c.TopNamespaces = 0 }, false},
+		{"negative top namespaces", func(c *Config) { c.TopNamespaces = -1 }, true},
+		{"zero output keep", func(c *Config) { c.OutputKeep = 0 }, true},
+		{"zero refresh interval", func(c *Config) { c.VersionRefreshInterval = 0 }, true},
+		{"disable detector", func(c *Config) { c.DisableDetectors = []string{"ip-stack"} }, false},
+		{"unknown detector", func(c *Config) { c.DisableDetectors = []string{"ipstack"} }, true},
+		{"empty tag name", func(c *Config) { c.Tags = map[string]string{"": "x"} }, true},
+		{"field name map", func(c *Config) { c.FieldNameMap = map[string]string{"serverNodeCount": "server_node_count"} }, false},
+		{"empty field name", func(c *Config) { c.FieldNameMap = map[string]string{"os": ""} }, true},
+		{"duplicate field name", func(c *Config) { c.FieldNameMap = map[string]string{"os": "x", "arch": "x"} }, true},
+		{"invalid node selector", func(c *Config) { c.NodeSelector = "a in (" }, true},
+		{"negative duration", func(c *Config) { c.RetryDelay.Duration = -time.Second }, true},
+		{"max run interval below run interval", func(c *Config) {
+			c.RunInterval.Duration = time.Hour
+			c.MaxRunInterval.Duration = time.Minute
+		}, true},
+		{"circuit breaker", func(c *Config) { c.CircuitBreakerThreshold = 3 }, false},
+		{"negative circuit breaker threshold", func(c *Config) { c.CircuitBreakerThreshold = -1 }, true},
+		{"circuit breaker without cooldown", func(c *Config) {
+			c.CircuitBreakerThreshold = 3
+			c.CircuitBreakerCooldown.Duration = 0
+		}, true},
+		{"negative min report interval", func(c *Config) { c.MinReportInterval.Duration = -time.Minute }, true},
+		{"send on change", func(c *Config) { c.SendOnChange = true; c.MaxReportAge.Duration = 0 }, false},
+		{"negative max report age", func(c *Config) { c.MaxReportAge.Duration = -time.Hour }, true},
+		{"invalid log level", func(c *Config) { c.LogLevel = "loud" }, true},
+		{"invalid log format", func(c *Config) { c.LogFormat = "xml" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(cfg)
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSendFailures is the number of consecutive failed sends after which the
+// probes report unhealthy.
+const maxSendFailures = 3
+
+// health records cycle outcomes and serves them as /healthz and /readyz.
+// A nil *health ignores updates, so cycles can run without probes.
+type health struct {
+	mu           sync.Mutex
+	collected    bool
+	lastSend     time.Time
+	sendFailures int
+}
+
+func (h *health) recordCollect() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.collected = true
+}
+
+func (h *health) recordSend(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.sendFailures++
+		return
+	}
+	h.sendFailures = 0
+	h.lastSend = time.Now()
+}
+
+// ServeHTTP returns 200 once a collection has succeeded, and 503 before that
+// or after maxSendFailures consecutive failed sends.
+func (h *health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	collected, lastSend, failures := h.collected, h.lastSend, h.sendFailures
+	h.mu.Unlock()
+
+	last := "never"
+	if !lastSend.IsZero() {
+		last = lastSend.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case !collected:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, "waiting for first collection")
+	case failures >= maxSendFailures:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintf(w, "%d consecutive send failures, last successful send: %s\n", failures, last)
+	default:
+		_, _ = fmt.Fprintf(w, "ok, last successful send: %s\n", last)
+	}
+}
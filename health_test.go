@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	sendFailed := errors.New("send failed")
+
+	tests := []struct {
+		name     string
+		collect  bool
+		sends    []error
+		wantCode int
+	}{
+		{"before first collection", false, nil, http.StatusServiceUnavailable},
+		{"collected without send", true, nil, http.StatusOK},
+		{"sent", true, []error{nil}, http.StatusOK},
+		{"some failures", true, []error{sendFailed, sendFailed}, http.StatusOK},
+		{"repeated failures", true, []error{nil, sendFailed, sendFailed, sendFailed}, http.StatusServiceUnavailable},
+		{"recovered", true, []error{sendFailed, sendFailed, sendFailed, nil}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health{}
+			if tt.collect {
+				h.recordCollect()
+			}
+			for _, err := range tt.sends {
+				h.recordSend(err)
+			}
+
+			for _, path := range []string{"/healthz", "/readyz"} {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.wantCode {
+					t.Errorf("%s status = %d, want %d (body %q)", path, rec.Code, tt.wantCode, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHealth_Nil(t *testing.T) {
+	var h *health
+	// Cycles without probes record into a nil health.
+	h.recordCollect()
+	h.recordSend(nil)
+}
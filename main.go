@@ -3,87 +3,756 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rancher/rke2-security-responder/telemetry"
 	"github.com/sirupsen/logrus"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
-var Version = "dev"
+// Build information, set at build time with -ldflags -X.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+const defaultCollectionTimeout = 60 * time.Second
+
+// defaultOutputKeep is the number of payload files kept in the output directory.
+const defaultOutputKeep = 30
+
+// defaultCircuitBreakerCooldown is how long an endpoint is skipped once its
+// circuit breaker opens.
+const defaultCircuitBreakerCooldown = time.Hour
+
+// defaultTopNamespaces is how many of the largest namespaces are reported.
+const defaultTopNamespaces = 5
+
+// defaultMinReportInterval is the shortest time allowed between two sends.
+const defaultMinReportInterval = time.Minute
+
+// defaultMaxReportAge is how long an unchanged payload may go unsent when
+// only changes are sent.
+const defaultMaxReportAge = 24 * time.Hour
+
+// exitNotInCluster is the exit status when no cluster is reachable because
+// the binary runs outside a pod without a kubeconfig, so that automation can
+// tell it apart from collection and send failures (status 1).
+const exitNotInCluster = 2
+
+// errNotInCluster is returned by kubeConfig when there is neither a
+// kubeconfig nor a usable in-cluster service account.
+var errNotInCluster = errors.New("not running in a cluster")
+
+// Log destinations for SECURITY_RESPONDER_LOG_OUTPUT other than a file path.
+const (
+	logOutputStdout = "stdout"
+	logOutputStderr = "stderr"
+)
 
+// Output modes for SECURITY_RESPONDER_OUTPUT_MODE when an output file is set.
+const (
+	outputModeBoth = "both" // write the file and send
+	outputModeFile = "file" // write the file only
+)
+
+// Flags take precedence over the matching SECURITY_RESPONDER_* environment
+// variables, which remain the primary interface inside the cluster and in
+// turn override the config file.
 var (
-	verbose = flag.Bool("verbose", false, "enable verbose logging")
-	debug   = flag.Bool("debug", false, "dry-run: collect data but don't send")
+	verbose     = flag.Bool("verbose", false, "enable verbose logging")
+	showVersion = flag.Bool("version", false, "print build information and exit (same as the version argument)")
+	debug       = flag.Bool("debug", false, "dry-run: print the payload to stdout instead of sending")
+	// The following are read by name through flagOrEnv.
+	_ = flag.String("endpoint", "", "telemetry endpoint, or a comma-separated list (env SECURITY_RESPONDER_ENDPOINT)")
+	_ = flag.Bool("dry-run", false, "print the payload to stdout instead of sending (env SECURITY_RESPONDER_DRY_RUN)")
+	_ = flag.Bool("self-test", false, "check the RBAC permissions the responder needs, print the results, and exit (env SECURITY_RESPONDER_SELF_TEST)")
+	_ = flag.Bool("disable-telemetry", false, "exit without collecting or sending (env SECURITY_RESPONDER_DISABLE_TELEMETRY)")
+	_ = flag.Duration("timeout", defaultCollectionTimeout, "collection timeout (env SECURITY_RESPONDER_COLLECTION_TIMEOUT)")
+	_ = flag.String("config", "", "path to a YAML config file (env SECURITY_RESPONDER_CONFIG_FILE)")
+	_ = flag.String("kubeconfig", "", "path to a kubeconfig, for running outside the cluster (env KUBECONFIG)")
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [version]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flag.CommandLine.Output(), "Flags override the corresponding SECURITY_RESPONDER_* environment variables.")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// Checked before loading the config, so it works with no cluster or settings.
+	if *showVersion || flag.Arg(0) == "version" {
+		printVersion(os.Stdout)
+		return
+	}
+
+	cfg, err := loadConfig(flag.CommandLine)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid configuration")
+	}
 	if *verbose {
-		logrus.SetLevel(logrus.DebugLevel)
+		cfg.LogLevel = "debug"
+	}
+	if *debug {
+		cfg.DryRun = true
+	}
+	if err := configureLogging(cfg); err != nil {
+		logrus.WithError(err).Fatal("invalid configuration")
 	}
 
-	if err := run(); err != nil {
+	if err := run(cfg); err != nil {
+		if errors.Is(err, errNotInCluster) {
+			logrus.WithError(err).Error("no cluster to collect from: the in-cluster config needs a pod with an automounted service account token " +
+				"and KUBERNETES_SERVICE_HOST set; outside a pod, pass --kubeconfig or set KUBECONFIG")
+			os.Exit(exitNotInCluster)
+		}
 		logrus.WithError(err).Fatal("run failed")
 	}
 }
 
-func run() error {
-	logrus.WithField("version", Version).Info("starting")
+// printVersion writes the build information set through -ldflags and the Go
+// version the binary was compiled with.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "rke2-security-responder %s\n", Version)
+	fmt.Fprintf(w, "  commit:     %s\n", Commit)
+	fmt.Fprintf(w, "  build date: %s\n", BuildDate)
+	fmt.Fprintf(w, "  go version: %s\n", runtime.Version())
+}
 
-	config, err := rest.InClusterConfig()
+// configureLogging applies the validated log level, format, and output.
+func configureLogging(cfg *Config) error {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+
+	if cfg.LogFormat == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}
+
+	out, err := logOutput(cfg.LogOutput)
+	if err != nil {
+		return err
+	}
+	logrus.SetOutput(out)
+	return nil
+}
+
+// logOutput returns the log destination: stdout, stderr (also for an empty
+// value), or a file path, which is appended to and created along with its
+// parent directories. The file stays open for the life of the process.
+func logOutput(dest string) (io.Writer, error) {
+	switch dest {
+	case "", logOutputStderr:
+		return os.Stderr, nil
+	case logOutputStdout:
+		return os.Stdout, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
 	if err != nil {
-		return fmt.Errorf("in-cluster config: %w", err)
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return f, nil
+}
+
+func run(cfg *Config) error {
+	logrus.WithFields(logrus.Fields{
+		"version":   Version,
+		"commit":    Commit,
+		"buildDate": BuildDate,
+	}).Info("starting")
+
+	// The self-test is meant to run before telemetry is enabled.
+	if cfg.DisableTelemetry && !cfg.SelfTest {
+		logrus.Info("telemetry disabled: skipping collection and send")
+		return nil
+	}
+
+	config, err := kubeConfig(cfg.Kubeconfig)
+	if err != nil {
+		return err
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return fmt.Errorf("kubernetes client: %w", err)
 	}
+	if cfg.SelfTest {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.CollectionTimeout.Duration)
+		defer cancel()
+		return selfTest(ctx, clientset, os.Stdout)
+	}
+	extensions, err := apiextensionsclientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("apiextensions client: %w", err)
+	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("metadata client: %w", err)
+	}
+
+	httpClient, err := telemetry.NewClient(telemetry.ClientOptions{
+		Proxy:              cfg.Proxy,
+		CACert:             cfg.CACert,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ClientCert:         cfg.ClientCert,
+		ClientKey:          cfg.ClientKey,
+		ConnectTimeout:     cfg.ConnectTimeout.Duration,
+		Timeout:            cfg.TotalTimeout.Duration,
+	})
+	if err != nil {
+		return fmt.Errorf("http client: %w", err)
+	}
+
+	sendOpts := telemetry.DefaultSendOptions()
+	sendOpts.Client = httpClient
+	sendOpts.UserAgent = "rke2-security-responder/" + Version
+	sendOpts.Compress = cfg.Compress
+	sendOpts.Format = cfg.Format
+	sendOpts.Method = cfg.Method
+	sendOpts.AuthToken = cfg.AuthToken
+	sendOpts.HMACKey = cfg.HMACKey
+	sendOpts.MaxRetries = cfg.MaxRetries
+	sendOpts.RetryDelay = cfg.RetryDelay.Duration
+	sendOpts.MaxRetryDelay = cfg.MaxRetryDelay.Duration
 
-	ctx := context.Background()
+	var versionCache *telemetry.VersionCache
+	if cfg.RunInterval.Duration > 0 {
+		versionCache = telemetry.NewVersionCache(cfg.VersionRefreshInterval)
+		sendOpts.Streaks = telemetry.NewFailureStreaks()
+		if cfg.CircuitBreakerThreshold > 0 {
+			sendOpts.Breaker = telemetry.NewCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown.Duration)
+		}
+	}
 
-	mode := os.Getenv("SECURITY_RESPONDER_MODE")
-	if mode == "" {
-		mode = "recommended"
+	c := &cycle{
+		clientset: clientset,
+		collectOpts: telemetry.CollectOptions{
+			Mode:                cfg.Mode,
+			Extensions:          extensions,
+			Metadata:            metadataClient,
+			VersionCache:        versionCache,
+			NodeSelector:        cfg.NodeSelector,
+			HashNodeNames:       cfg.HashNodeNames,
+			BestEffort:          cfg.BestEffort,
+			DisableDetectors:    cfg.DisableDetectors,
+			CNINamespaces:       cfg.CNINamespaces,
+			TopNamespaces:       cfg.TopNamespaces,
+			IncludeRuntimeStats: cfg.IncludeRuntimeStats,
+			HashClusterUUID:     cfg.HashClusterUUID,
+			ClusterUUIDSalt:     cfg.ClusterUUIDSalt,
+		},
+		collectionTimeout: cfg.CollectionTimeout.Duration,
+		fields:            cfg.Fields,
+		fieldNameMap:      cfg.FieldNameMap,
+		tags:              cfg.Tags,
+		schemaVersion:     cfg.SchemaVersion,
+		outputFile:        cfg.OutputFile,
+		outputDir:         cfg.OutputDir,
+		outputKeep:        cfg.OutputKeep,
+		outputMode:        cfg.OutputMode,
+		dryRun:            cfg.DryRun,
+		dev:               cfg.Dev,
+		endpoints:         cfg.Endpoints,
+		requireAll:        cfg.RequireAll,
+		sendOpts:          sendOpts,
+		minReportInterval: cfg.MinReportInterval.Duration,
+		sendOnChange:      cfg.SendOnChange,
+		maxReportAge:      cfg.MaxReportAge.Duration,
+		stateFile:         cfg.StateFile,
+	}
+	if c.stateFile != "" {
+		state, err := readState(c.stateFile)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to read state file")
+		}
+		c.lastSend, c.lastDigest = state.lastSend, state.digest
 	}
 
-	data, err := telemetry.Collect(ctx, clientset, mode)
+	// Metrics and probes share a listener when configured with the same address.
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if cfg.MetricsAddr != "" {
+		muxFor(cfg.MetricsAddr).Handle("/metrics", telemetry.MetricsHandler())
+	}
+	if cfg.HealthAddr != "" {
+		c.health = &health{}
+		muxFor(cfg.HealthAddr).Handle("/healthz", c.health)
+		muxFor(cfg.HealthAddr).Handle("/readyz", c.health)
+	}
+	for addr, mux := range muxes {
+		stop := startServer(addr, mux)
+		defer stop()
+	}
+
+	// SIGTERM cancels an in-flight collection or send so the pod exits promptly.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err := startupDelay(ctx, cfg.StartupJitter.Duration); err != nil {
+		logrus.Info("shutdown signal received, exiting")
+		return nil
+	}
+
+	if cfg.RunInterval.Duration == 0 {
+		err = c.run(ctx)
+	} else {
+		interval, maxInterval := cfg.RunInterval.Duration, cfg.maxRunInterval()
+		logrus.WithFields(logrus.Fields{"interval": interval, "maxInterval": maxInterval}).Info("running periodically")
+		err = runEvery(ctx, func() time.Duration {
+			delay := sendOpts.Streaks.Delay(interval, maxInterval)
+			if delay > interval {
+				logrus.WithField("nextRunIn", delay).Warn("all endpoints failing, backing off")
+			}
+			return delay
+		}, c.run)
+	}
+	if ctx.Err() != nil {
+		logrus.Info("shutdown signal received, exiting")
+		return nil
+	}
+	return err
+}
+
+// startupDelay sleeps for a random duration in [0, jitter) so that clusters
+// on the same schedule do not all report at once. It returns ctx's error if
+// ctx is done first.
+func startupDelay(ctx context.Context, jitter time.Duration) error {
+	if jitter <= 0 {
+		return nil
+	}
+	delay := rand.N(jitter) // #nosec G404 -- jitter does not need a CSPRNG
+	logrus.WithFields(logrus.Fields{"delay": delay, "maxJitter": jitter}).Info("delaying start")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// runEvery calls fn immediately and then again after each delay returned by
+// next, until ctx is done. Failed cycles are logged and retried.
+func runEvery(ctx context.Context, next func() time.Duration, fn func(ctx context.Context) error) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("run failed, retrying at next interval")
+		}
+		timer.Reset(next())
+	}
+}
+
+// cycle is a single collect-and-send pass.
+type cycle struct {
+	clientset         kubernetes.Interface
+	collectOpts       telemetry.CollectOptions
+	collectionTimeout time.Duration
+	fields            []string
+	fieldNameMap      map[string]string
+	tags              map[string]string
+	schemaVersion     string
+	outputFile        string
+	outputDir         string
+	outputKeep        int
+	outputMode        string
+	dryRun            bool
+	dev               bool
+	endpoints         []string
+	requireAll        bool
+	sendOpts          telemetry.SendOptions
+	health            *health
+	minReportInterval time.Duration
+	sendOnChange      bool
+	maxReportAge      time.Duration
+	stateFile         string
+	lastSend          time.Time
+	lastDigest        string
+}
+
+func (c *cycle) run(ctx context.Context) error {
+	collectCtx, cancel := context.WithTimeout(ctx, c.collectionTimeout)
+	defer cancel()
+	data, err := telemetry.Collect(collectCtx, c.clientset, c.collectOpts)
 	if err != nil {
 		return fmt.Errorf("collect data: %w", err)
 	}
+	c.health.recordCollect()
+
+	if len(c.fields) > 0 {
+		data.Filter(c.fields)
+	}
+
+	data.ExtraTagInfo["responderVersion"] = Version
+	data.ExtraTagInfo["responderCommit"] = Commit
+	data.ExtraTagInfo["responderBuildDate"] = BuildDate
+	data.AddTags(c.tags)
+	if c.schemaVersion != "" {
+		data.SchemaVersion = c.schemaVersion
+	}
 
 	// Mark non-release builds for server-side filtering
 	// Clean tags: v1.2.3, v1.2.3-rc1, v1.2.3+rke2r1
 	// Non-clean: v1.2.3-5-gabcdef (commits after tag), v1.2.3-dirty, abcdef (no tag), dev
-	if !isReleaseVersion(Version) || os.Getenv("SECURITY_RESPONDER_DEV") == "true" {
+	if !isReleaseVersion(Version) || c.dev {
 		data.ExtraFieldInfo["dev"] = true
 	}
+	// The digest is taken before renaming, so that it skips the volatile
+	// fields under their own names.
+	digest, err := data.Digest()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to compute payload digest")
+	}
+	// Renamed last, so that the map also covers the tags added above and the
+	// saved, printed, and sent payloads agree.
+	if len(c.fieldNameMap) > 0 {
+		data.RenameFields(c.fieldNameMap)
+	}
 
-	if *debug {
-		jsonData, _ := json.MarshalIndent(data, "", "  ")
-		logrus.WithField("payload", string(jsonData)).Info("debug mode: skipping send")
+	if c.outputFile != "" {
+		if err := writePayloadFile(c.outputFile, data); err != nil {
+			logrus.WithError(err).Warn("failed to write payload file")
+		} else {
+			logrus.WithField("path", c.outputFile).Info("payload written")
+		}
+	}
+	if c.outputDir != "" {
+		writePayloadHistory(c.outputDir, c.outputKeep, data, time.Now())
+	}
+	if (c.outputFile != "" || c.outputDir != "") && c.outputMode == outputModeFile {
 		return nil
 	}
 
-	endpoint := os.Getenv("SECURITY_RESPONDER_ENDPOINT")
-	if endpoint == "" {
-		endpoint = telemetry.DefaultEndpoint
+	if c.dryRun {
+		jsonData, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal payload: %w", err)
+		}
+		// The payload goes to stdout, separate from the logs, so it can be reviewed verbatim.
+		if _, err := fmt.Fprintln(os.Stdout, string(jsonData)); err != nil {
+			return fmt.Errorf("print payload: %w", err)
+		}
+		logrus.Info("debug mode: skipping send")
+		return nil
+	}
+
+	if since := time.Since(c.lastSend); c.minReportInterval > 0 && !c.lastSend.IsZero() && since >= 0 && since < c.minReportInterval {
+		logrus.WithFields(logrus.Fields{"lastSend": c.lastSend, "minReportInterval": c.minReportInterval}).Info("sent too recently, skipping send")
+		return nil
+	}
+	if c.sendOnChange && digest != "" && digest == c.lastDigest {
+		if age := time.Since(c.lastSend); c.maxReportAge == 0 || (age >= 0 && age < c.maxReportAge) {
+			logrus.WithFields(logrus.Fields{"lastSend": c.lastSend, "maxReportAge": c.maxReportAge}).Info("payload unchanged since last report, skipping send")
+			return nil
+		}
 	}
 
-	if _, err := telemetry.Send(ctx, data, endpoint); err != nil {
+	err = telemetry.SendAll(ctx, data, c.endpoints, c.sendOpts, c.requireAll)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("send interrupted: %w", err)
+	}
+	c.health.recordSend(err)
+	if err != nil {
 		logrus.WithError(err).Warn("failed to send (expected in disconnected environments)")
+		return nil
+	}
+	c.lastSend, c.lastDigest = time.Now(), digest
+	if c.stateFile != "" {
+		if err := writeState(c.stateFile, sendState{lastSend: c.lastSend, digest: c.lastDigest}); err != nil {
+			logrus.WithError(err).Warn("failed to write state file")
+		}
+	}
+
+	return nil
+}
+
+// serviceAccountTokenPath is mounted into every pod whose service account
+// token is automounted; its presence identifies an in-cluster run.
+var serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// kubeConfig returns the REST config from the given kubeconfig path, falling
+// back to KUBECONFIG and then to the in-cluster service account.
+func kubeConfig(path string) (*rest.Config, error) {
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %w", path, err)
+		}
+		logrus.WithField("kubeconfig", path).Debug("using kubeconfig")
+		return config, nil
+	}
+	if _, err := os.Stat(serviceAccountTokenPath); err != nil {
+		return nil, fmt.Errorf("%w: no service account token at %s", errNotInCluster, serviceAccountTokenPath)
+	}
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		return nil, fmt.Errorf("%w: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set", errNotInCluster)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("in-cluster config: %w", err)
+	}
+	return config, nil
+}
+
+// flagOrEnv returns the value of the named flag if it was given on the command
+// line, otherwise the value of the environment variable env.
+func flagOrEnv(fs *flag.FlagSet, name, env string) string {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	if set {
+		return fs.Lookup(name).Value.String()
+	}
+	return os.Getenv(env)
+}
+
+// loadSecret returns the contents of the file at path, preferring it over
+// the inline value. name identifies the setting in errors, which never
+// include the secret itself.
+func loadSecret(name, inline, path string) (string, error) {
+	if path == "" {
+		return inline, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	secret := strings.TrimSpace(string(raw))
+	if secret == "" {
+		return "", fmt.Errorf("%s %q is empty", name, path)
+	}
+	return secret, nil
+}
+
+// startServer serves handler on addr until the returned stop function is called.
+func startServer(addr string, handler http.Handler) func() {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		logrus.WithField("addr", addr).Info("serving HTTP endpoints")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Warn("HTTP server failed")
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Warn("failed to stop HTTP server")
+		}
+	}
+}
+
+// writePayloadFile writes the indented payload to path, creating parent directories.
+func writePayloadFile(path string, data *telemetry.Data) error {
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(jsonData, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	return nil
+}
+
+// historyPrefix and historyTimeFormat name the files in the output
+// directory; the UTC timestamps sort in the order the files were written.
+const (
+	historyPrefix     = "payload-"
+	historyTimeFormat = "20060102T150405.000Z"
+)
+
+// writePayloadHistory writes the payload to a timestamped file in dir and
+// then deletes the oldest files beyond keep. Failures are logged, never
+// returned, so that the run continues.
+func writePayloadHistory(dir string, keep int, data *telemetry.Data, now time.Time) {
+	path := filepath.Join(dir, historyPrefix+now.UTC().Format(historyTimeFormat)+".json")
+	if err := writePayloadFile(path, data); err != nil {
+		logrus.WithError(err).Warn("failed to write payload history")
+		return
+	}
+	logrus.WithField("path", path).Info("payload written")
+	if err := pruneHistory(dir, keep); err != nil {
+		logrus.WithError(err).Warn("failed to prune payload history")
 	}
+}
 
+// pruneHistory deletes all but the newest keep payload files in dir. Other
+// files are left alone.
+func pruneHistory(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if name := entry.Name(); entry.Type().IsRegular() && strings.HasPrefix(name, historyPrefix) && strings.HasSuffix(name, ".json") {
+			files = append(files, name)
+		}
+	}
+	if len(files) <= keep {
+		return nil
+	}
+	sort.Strings(files)
+	var errs []error
+	for _, name := range files[:len(files)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logrus.WithField("file", name).Debug("deleted old payload")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete old payloads: %w", errors.Join(errs...))
+	}
 	return nil
 }
 
+// sendState is what the state file records about the last successful send.
+type sendState struct {
+	lastSend time.Time
+	// digest is the payload digest, empty if it could not be computed.
+	digest string
+}
+
+// readState returns the state recorded in the file at path, or the zero
+// state if the file does not exist yet. The file holds the RFC 3339 send
+// time on its first line and the digest, if any, on the second.
+func readState(path string) (sendState, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sendState{}, nil
+	}
+	if err != nil {
+		return sendState{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(lines[0]))
+	if err != nil {
+		return sendState{}, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	state := sendState{lastSend: t}
+	if len(lines) > 1 {
+		state.digest = strings.TrimSpace(lines[1])
+	}
+	return state, nil
+}
+
+// writeState records state in the file at path.
+func writeState(path string, state sendState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	content := state.lastSend.UTC().Format(time.RFC3339Nano) + "\n"
+	if state.digest != "" {
+		content += state.digest + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// envInt returns the integer value of the named environment variable, or def if unset.
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, v, err)
+	}
+	return n, nil
+}
+
+// envDuration returns the duration value of the named environment variable, or def if unset.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	return parseDuration(name, os.Getenv(name), def)
+}
+
+// parseDuration parses v as a non-negative duration, returning def if v is
+// empty. name identifies the setting in errors.
+func parseDuration(name, v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, v, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", name, v)
+	}
+	return d, nil
+}
+
+// envList returns the comma-separated values of the named environment variable.
+func envList(name string) []string {
+	return splitList(os.Getenv(name))
+}
+
+// splitList returns the non-empty, trimmed values of a comma-separated list.
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 // releaseVersionRe matches clean release tags: v1.2.3, v1.2.3-rc1, v1.2.3+rke2r1
 // but NOT git describe output like v1.2.3-5-gabcdef or v1.2.3-dirty
 var releaseVersionRe = regexp.MustCompile(`^v\d+\.\d+\.\d+([+-][a-zA-Z][a-zA-Z0-9]*)?$`)
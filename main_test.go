@@ -1,7 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/rancher/rke2-security-responder/telemetry"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestIsReleaseVersion(t *testing.T) {
@@ -41,8 +62,613 @@ func TestIsReleaseVersion(t *testing.T) {
 }
 
 func TestRun_OutsideCluster(t *testing.T) {
-	err := run()
+	t.Setenv("KUBECONFIG", "")
+	err := run(defaultConfig())
+	if !errors.Is(err, errNotInCluster) {
+		t.Errorf("run() outside k8s cluster error = %v, want %v", err, errNotInCluster)
+	}
+}
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"unset", "", 7, false},
+		{"zero", "0", 0, false},
+		{"positive", "5", 5, false},
+		{"not a number", "five", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_ENV_INT", tt.value)
+			got, err := envInt("TEST_ENV_INT", 7)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("envInt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("envInt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"unset", "", 2 * time.Second, false},
+		{"valid", "500ms", 500 * time.Millisecond, false},
+		{"zero", "0", 0, false},
+		{"negative", "-1s", 0, true},
+		{"not a duration", "soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_ENV_DURATION", tt.value)
+			got, err := envDuration("TEST_ENV_DURATION", 2*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("envDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("envDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a, b ,,c", []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TEST_ENV_LIST", tt.value)
+			if got := envList("TEST_ENV_LIST"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("envList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePayloadFile(t *testing.T) {
+	data := &telemetry.Data{
+		AppVersion:     "v1.30.0",
+		ExtraTagInfo:   map[string]string{"clusteruuid": "test"},
+		ExtraFieldInfo: map[string]interface{}{"mode": "recommended"},
+	}
+	path := filepath.Join(t.TempDir(), "nested", "dir", "payload.json")
+
+	if err := writePayloadFile(path, data); err != nil {
+		t.Fatalf("writePayloadFile() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var got telemetry.Data
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	if got.ExtraTagInfo["clusteruuid"] != "test" {
+		t.Errorf("clusteruuid = %q, want test", got.ExtraTagInfo["clusteruuid"])
+	}
+}
+
+func TestWritePayloadFile_Unwritable(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(parent, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writePayloadFile(filepath.Join(parent, "payload.json"), &telemetry.Data{})
 	if err == nil {
-		t.Error("run() outside k8s cluster should return error")
+		t.Error("writePayloadFile() expected error when parent is a file")
+	}
+}
+
+func TestSendState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "last-send")
+	if got, err := readState(path); err != nil || got != (sendState{}) {
+		t.Errorf("readState() on missing file = %+v, %v; want zero state", got, err)
+	}
+
+	for _, want := range []sendState{
+		{lastSend: time.Date(2025, 1, 15, 8, 0, 0, 123, time.UTC), digest: "abc123"},
+		{lastSend: time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)},
+	} {
+		if err := writeState(path, want); err != nil {
+			t.Fatalf("writeState() error = %v", err)
+		}
+		if got, err := readState(path); err != nil || !got.lastSend.Equal(want.lastSend) || got.digest != want.digest {
+			t.Errorf("readState() = %+v, %v; want %+v", got, err, want)
+		}
+	}
+
+	// State files written before digests were recorded hold only the time.
+	if err := os.WriteFile(path, []byte("2025-01-15T08:00:00Z\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readState(path); err != nil || got.lastSend.IsZero() || got.digest != "" {
+		t.Errorf("readState() = %+v, %v; want the time and no digest", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("yesterday\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readState(path); err == nil {
+		t.Error("readState() expected error for malformed state")
+	}
+}
+
+func TestCycle_MinReportInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		lastSend time.Duration // before now; 0 means never
+		min      time.Duration
+		dryRun   bool
+		wantSent bool
+	}{
+		{"never sent", 0, time.Minute, false, true},
+		{"sent too recently", 10 * time.Second, time.Minute, false, false},
+		{"interval elapsed", 2 * time.Minute, time.Minute, false, true},
+		{"guard disabled", 10 * time.Second, 0, false, true},
+		{"dry run still collects", 10 * time.Second, time.Minute, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				_ = json.NewEncoder(w).Encode(telemetry.Response{})
+			}))
+			defer server.Close()
+
+			state := filepath.Join(t.TempDir(), "last-send")
+			c := &cycle{
+				clientset: fake.NewClientset(
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+				),
+				collectOpts:       telemetry.CollectOptions{Mode: "recommended"},
+				collectionTimeout: time.Minute,
+				dryRun:            tt.dryRun,
+				endpoints:         []string{server.URL},
+				sendOpts:          telemetry.DefaultSendOptions(),
+				minReportInterval: tt.min,
+				stateFile:         state,
+			}
+			if tt.lastSend > 0 {
+				c.lastSend = time.Now().Add(-tt.lastSend)
+			}
+			before := c.lastSend
+
+			if err := c.run(context.Background()); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if sent := requests.Load() > 0; sent != tt.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+
+			recorded, err := readState(state)
+			if err != nil {
+				t.Fatalf("readState() error = %v", err)
+			}
+			if tt.wantSent && !recorded.lastSend.After(before) {
+				t.Errorf("state file = %v, want a time after %v", recorded, before)
+			}
+			if !tt.wantSent && !recorded.lastSend.IsZero() {
+				t.Errorf("state file = %v, want unwritten", recorded.lastSend)
+			}
+		})
 	}
 }
+
+func TestCycle_SendOnChange(t *testing.T) {
+	kubeSystem := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+
+	tests := []struct {
+		name         string
+		sendOnChange bool
+		maxAge       time.Duration
+		lastSend     time.Duration // before now
+		changed      bool
+		wantSent     bool
+	}{
+		{"unchanged", true, time.Hour, time.Minute, false, false},
+		{"changed", true, time.Hour, time.Minute, true, true},
+		{"unchanged but too old", true, time.Hour, 2 * time.Hour, false, true},
+		{"unchanged without max age", true, 0, 48 * time.Hour, false, false},
+		{"disabled", false, time.Hour, time.Minute, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				_ = json.NewEncoder(w).Encode(telemetry.Response{})
+			}))
+			defer server.Close()
+
+			clientset := fake.NewClientset(kubeSystem)
+			state := filepath.Join(t.TempDir(), "last-send")
+			c := &cycle{
+				clientset:         clientset,
+				collectOpts:       telemetry.CollectOptions{Mode: "recommended"},
+				collectionTimeout: time.Minute,
+				endpoints:         []string{server.URL},
+				sendOpts:          telemetry.DefaultSendOptions(),
+				sendOnChange:      tt.sendOnChange,
+				maxReportAge:      tt.maxAge,
+				stateFile:         state,
+			}
+			// A first report records the digest.
+			if err := c.run(context.Background()); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			recorded, err := readState(state)
+			if err != nil || recorded.digest == "" {
+				t.Fatalf("readState() = %+v, %v; want a digest", recorded, err)
+			}
+			c.lastSend = time.Now().Add(-tt.lastSend)
+			if tt.changed {
+				if _, err := clientset.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := c.run(context.Background()); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if sent := requests.Load() == 2; sent != tt.wantSent {
+				t.Errorf("second report sent = %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestWritePayloadHistory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	data := &telemetry.Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+	start := time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		writePayloadHistory(dir, 3, data, start.Add(time.Duration(i)*time.Hour))
+		if i == 0 {
+			// Unrelated files are never pruned.
+			if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	want := []string{
+		"notes.txt",
+		"payload-20250115T100000.000Z.json",
+		"payload-20250115T110000.000Z.json",
+		"payload-20250115T120000.000Z.json",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output directory = %v, want %v", got, want)
+	}
+}
+
+func TestWritePayloadHistory_Unwritable(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(parent, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Failures are logged; the call must not panic or create anything.
+	writePayloadHistory(filepath.Join(parent, "history"), 3, &telemetry.Data{}, time.Now())
+	if _, err := os.Stat(filepath.Join(parent, "history")); err == nil {
+		t.Error("output directory created under a file")
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+	defer logrus.SetOutput(logrus.StandardLogger().Out)
+
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantLevel logrus.Level
+		wantJSON  bool
+	}{
+		{"defaults", "info", "text", logrus.InfoLevel, false},
+		{"debug json", "debug", "json", logrus.DebugLevel, true},
+		{"warn", "warn", "text", logrus.WarnLevel, false},
+		{"error", "error", "text", logrus.ErrorLevel, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := configureLogging(&Config{LogLevel: tt.level, LogFormat: tt.format}); err != nil {
+				t.Fatalf("configureLogging() error = %v", err)
+			}
+			if logrus.GetLevel() != tt.wantLevel {
+				t.Errorf("level = %v, want %v", logrus.GetLevel(), tt.wantLevel)
+			}
+			if _, isJSON := logrus.StandardLogger().Formatter.(*logrus.JSONFormatter); isJSON != tt.wantJSON {
+				t.Errorf("JSON formatter = %v, want %v", isJSON, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestLogOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "responder.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("earlier\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dest    string
+		want    io.Writer
+		wantErr bool
+	}{
+		{"", os.Stderr, false},
+		{"stderr", os.Stderr, false},
+		{"stdout", os.Stdout, false},
+		{filepath.Join(blocker, "responder.log"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dest, func(t *testing.T) {
+			got, err := logOutput(tt.dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("logOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("logOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, p := range []string{path, filepath.Join(dir, "new", "dir", "responder.log")} {
+		t.Run(p, func(t *testing.T) {
+			w, err := logOutput(p)
+			if err != nil {
+				t.Fatalf("logOutput() error = %v", err)
+			}
+			if _, err := io.WriteString(w, "appended\n"); err != nil {
+				t.Fatal(err)
+			}
+			_ = w.(*os.File).Close()
+		})
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "earlier\nappended\n" {
+		t.Errorf("log file = %q, %v; want appended line", got, err)
+	}
+}
+
+func TestLoadSecret(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		inline  string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{"unset", "", "", "", false},
+		{"inline", "inline-token", "", "inline-token", false},
+		{"file", "", tokenFile, "from-file", false},
+		{"file preferred", "inline-token", tokenFile, "from-file", false},
+		{"missing file", "", filepath.Join(dir, "missing"), "", true},
+		{"empty file", "", emptyFile, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadSecret("authTokenFile", tt.inline, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("loadSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagOrEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		args []string
+		env  string
+		want string
+	}{
+		{"neither", "endpoint", nil, "", ""},
+		{"env only", "endpoint", nil, "https://env.example.com", "https://env.example.com"},
+		{"flag only", "endpoint", []string{"--endpoint=https://flag.example.com"}, "", "https://flag.example.com"},
+		{"flag overrides env", "endpoint", []string{"--endpoint=https://flag.example.com"}, "https://env.example.com", "https://flag.example.com"},
+		{"bool flag overrides env", "dry-run", []string{"--dry-run=false"}, "true", "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("endpoint", "", "")
+			fs.Bool("dry-run", false, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			t.Setenv("TEST_FLAG_OR_ENV", tt.env)
+			if got := flagOrEnv(fs, tt.flag, "TEST_FLAG_OR_ENV"); got != tt.want {
+				t.Errorf("flagOrEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubeConfig(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "kubeconfig")
+	kubeconfigData := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfigData), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	serviceAccountTokenPath = filepath.Join(dir, "token")
+	t.Cleanup(func() { serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token" })
+
+	tests := []struct {
+		name           string
+		flag           string
+		env            string
+		token          bool
+		wantHost       string
+		wantErr        bool
+		wantNotCluster bool
+	}{
+		{"flag", kubeconfigPath, "", false, "https://127.0.0.1:6443", false, false},
+		{"env", "", kubeconfigPath, false, "https://127.0.0.1:6443", false, false},
+		{"flag overrides env", kubeconfigPath, filepath.Join(dir, "missing"), false, "https://127.0.0.1:6443", false, false},
+		{"missing file", filepath.Join(dir, "missing"), "", false, "", true, false},
+		{"no kubeconfig and no service account", "", "", false, "", true, true},
+		{"service account outside a pod", "", "", true, "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+			_ = os.Remove(serviceAccountTokenPath)
+			if tt.token {
+				if err := os.WriteFile(serviceAccountTokenPath, []byte("token"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config, err := kubeConfig(tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kubeConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if notCluster := errors.Is(err, errNotInCluster); notCluster != tt.wantNotCluster {
+				t.Errorf("kubeConfig() error = %v, want not-in-cluster %v", err, tt.wantNotCluster)
+			}
+			if err == nil && config.Host != tt.wantHost {
+				t.Errorf("Host = %q, want %q", config.Host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestRunEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	err := runEvery(ctx, func() time.Duration { return time.Millisecond }, func(ctx context.Context) error {
+		calls++
+		if calls == 3 {
+			cancel()
+			return ctx.Err()
+		}
+		// Failed cycles must not stop the loop.
+		return errors.New("cycle failed")
+	})
+	if err != nil {
+		t.Errorf("runEvery() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("runEvery() ran %d cycles, want 3", calls)
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.3", "abc1234", "2025-01-10T12:00:00Z"
+
+	var buf bytes.Buffer
+	printVersion(&buf)
+	for _, want := range []string{"rke2-security-responder v1.2.3", "commit:     abc1234", "build date: 2025-01-10T12:00:00Z", "go version: " + runtime.Version()} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("printVersion() = %q, missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestStartupDelay(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		if err := startupDelay(context.Background(), 0); err != nil {
+			t.Errorf("startupDelay() error = %v", err)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		start := time.Now()
+		if err := startupDelay(context.Background(), 20*time.Millisecond); err != nil {
+			t.Errorf("startupDelay() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("startupDelay() slept %v, want under the jitter", elapsed)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := startupDelay(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+			t.Errorf("startupDelay() error = %v, want context.Canceled", err)
+		}
+	})
+}
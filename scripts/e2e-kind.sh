@@ -62,6 +62,8 @@ helm upgrade --install rke2-security-responder "${ROOT_DIR}/charts/rke2-security
     --set image.repository=rke2-security-responder \
     --set image.tag=e2e \
     --set check.endpoint="http://mock-responder.kube-system.svc.cluster.local:80" \
+    --set "extraEnv[0].name=SECURITY_RESPONDER_ALLOW_INSECURE" \
+    --set-string "extraEnv[0].value=true" \
     --wait
 
 echo "=== Creating test job ==="
@@ -99,14 +99,14 @@ if ! echo "${LOGS}" | grep -q "debug mode: skipping send"; then
 fi
 
 # RKE2-specific: should detect canal CNI
-if echo "${LOGS}" | grep -q '"cni-plugin":"canal"'; then
+if echo "${LOGS}" | grep -Eq '"cni-plugin": ?"canal"'; then
     echo "OK: Canal CNI detected"
 else
     echo "WARNING: Canal CNI not detected (may be expected depending on RKE2 config)"
 fi
 
 # RKE2-specific: should detect rke2-ingress-nginx
-if echo "${LOGS}" | grep -q '"ingress-controller":"rke2-ingress-nginx"'; then
+if echo "${LOGS}" | grep -Eq '"ingress-controller": ?"rke2-ingress-nginx"'; then
     echo "OK: RKE2 ingress-nginx detected"
 else
     echo "WARNING: RKE2 ingress-nginx not detected (may still be deploying)"
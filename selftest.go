@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// permission is one API access the responder uses. It mirrors a rule of the
+// chart's ClusterRole; keep the two in sync.
+type permission struct {
+	verb, group, resource, namespace, name string
+	purpose                                string
+	// optional permissions are granted only by opt-in chart values; their
+	// absence is reported but does not fail the self-test.
+	optional bool
+}
+
+var permissions = []permission{
+	{verb: "list", resource: "nodes", purpose: "node information"},
+	{verb: "get", resource: "namespaces", purpose: "cluster UUID and Rancher detection"},
+	{verb: "list", resource: "namespaces", purpose: "namespace count and Pod Security levels"},
+	{verb: "get", group: "apps", resource: "daemonsets", purpose: "Rancher agent detection"},
+	{verb: "list", group: "apps", resource: "daemonsets", purpose: "CNI, load balancer, and GPU operator detection"},
+	{verb: "get", group: "apps", resource: "deployments", purpose: "Rancher and add-on detection"},
+	{verb: "list", group: "apps", resource: "deployments", purpose: "ingress controller detection"},
+	{verb: "get", resource: "services", purpose: "IP stack detection"},
+	{verb: "list", resource: "services", purpose: "exposed Service counts"},
+	{verb: "get", resource: "endpoints", namespace: metav1.NamespaceDefault, name: "kubernetes", purpose: "API server endpoint count (before Kubernetes 1.21)"},
+	{verb: "list", resource: "pods", purpose: "pod counts and audit logging detection"},
+	{verb: "get", resource: "configmaps", namespace: metav1.NamespaceSystem, name: "audit-policy", purpose: "audit logging detection"},
+	{verb: "get", resource: "configmaps", namespace: metav1.NamespacePublic, name: "local-registry-hosting", purpose: "local registry detection"},
+	{verb: "list", resource: "secrets", purpose: "image pull secret count (chart value privateRegistryDetection)", optional: true},
+	{verb: "list", group: "discovery.k8s.io", resource: "endpointslices", namespace: metav1.NamespaceDefault, purpose: "API server endpoint count"},
+	{verb: "list", group: "storage.k8s.io", resource: "csidrivers", purpose: "CSI drivers"},
+	{verb: "list", group: "storage.k8s.io", resource: "storageclasses", purpose: "default StorageClass"},
+	{verb: "get", group: "networking.k8s.io", resource: "networkpolicies", purpose: "CIS profile detection"},
+	{verb: "list", group: "networking.k8s.io", resource: "networkpolicies", purpose: "NetworkPolicy counts"},
+	{verb: "get", group: "networking.k8s.io", resource: "servicecidrs", name: "kubernetes", purpose: "service CIDR"},
+	{verb: "list", group: "admissionregistration.k8s.io", resource: "validatingwebhookconfigurations", purpose: "webhook counts"},
+	{verb: "list", group: "admissionregistration.k8s.io", resource: "mutatingwebhookconfigurations", purpose: "webhook counts"},
+	{verb: "list", group: "apiextensions.k8s.io", resource: "customresourcedefinitions", purpose: "CRD counts"},
+}
+
+// String formats p as resource[.group][/name], with the namespace in
+// parentheses when the permission is namespaced.
+func (p permission) String() string {
+	s := p.resource
+	if p.group != "" {
+		s += "." + p.group
+	}
+	if p.name != "" {
+		s += "/" + p.name
+	}
+	if p.namespace != "" {
+		s += " (" + p.namespace + ")"
+	}
+	return s
+}
+
+// selfTest checks each permission with a SelfSubjectAccessReview and writes
+// a pass/fail table to w. It fails if a required permission is missing or
+// could not be checked.
+func selfTest(ctx context.Context, clientset kubernetes.Interface, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tVERB\tRESOURCE\tPURPOSE")
+	missing := 0
+	for _, p := range permissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:      p.verb,
+					Group:     p.group,
+					Resource:  p.resource,
+					Namespace: p.namespace,
+					Name:      p.name,
+				},
+			},
+		}
+		result := "pass"
+		resp, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		switch {
+		case err != nil:
+			logrus.WithError(err).WithField("permission", p.String()).Warn("failed to check permission")
+			result = "error"
+			missing++
+		case resp.Status.Allowed:
+		case p.optional:
+			result = "skip"
+		default:
+			result = "FAIL"
+			missing++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result, p.verb, p, p.purpose)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to print self-test results: %w", err)
+	}
+	if missing > 0 {
+		return fmt.Errorf("self-test failed: %d of %d permissions missing or not checked", missing, len(permissions))
+	}
+	return nil
+}
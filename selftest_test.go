@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name    string
+		denied  map[string]bool // by resource
+		failed  bool
+		wantErr bool
+		want    []string
+	}{
+		{"all allowed", nil, false, false, []string{"pass list nodes"}},
+		{"optional missing", map[string]bool{"secrets": true}, false, false, []string{"skip list secrets", "pass list nodes"}},
+		{"required missing", map[string]bool{"nodes": true}, false, true, []string{"FAIL list nodes"}},
+		{"review failed", nil, true, true, []string{"error list nodes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset()
+			clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if tt.failed {
+					return true, nil, errors.New("unavailable")
+				}
+				review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+				review.Status.Allowed = !tt.denied[review.Spec.ResourceAttributes.Resource]
+				return true, review, nil
+			})
+
+			var out bytes.Buffer
+			err := selfTest(context.Background(), clientset, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selfTest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(permissions)+1 {
+				t.Errorf("printed %d lines, want a header and %d results", len(lines), len(permissions))
+			}
+			// Rows are matched on their result, verb, and resource columns.
+			var rows []string
+			for _, line := range lines {
+				if fields := strings.Fields(line); len(fields) >= 3 {
+					rows = append(rows, strings.Join(fields[:3], " "))
+				}
+			}
+			for _, want := range tt.want {
+				if !slices.Contains(rows, want) {
+					t.Errorf("output missing row %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+// TestSelfTest_MatchesClusterRole checks that the chart grants every
+// permission the self-test expects, with the opt-in rules enabled.
+func TestSelfTest_MatchesClusterRole(t *testing.T) {
+	raw, err := os.ReadFile("charts/rke2-security-responder/templates/clusterrole.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop template directives; the conditional rules are kept.
+	var lines []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		if !strings.Contains(line, "{{") {
+			lines = append(lines, line)
+		}
+	}
+	var role rbacv1.ClusterRole
+	if err := yaml.Unmarshal([]byte(strings.Join(lines, "\n")), &role); err != nil {
+		t.Fatalf("failed to parse ClusterRole: %v", err)
+	}
+
+	for _, p := range permissions {
+		granted := slices.ContainsFunc(role.Rules, func(rule rbacv1.PolicyRule) bool {
+			return slices.Contains(rule.APIGroups, p.group) &&
+				slices.Contains(rule.Resources, p.resource) &&
+				slices.Contains(rule.Verbs, p.verb) &&
+				(len(rule.ResourceNames) == 0 || slices.Contains(rule.ResourceNames, p.name))
+		})
+		if !granted {
+			t.Errorf("ClusterRole does not grant %s %s", p.verb, p)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// findDeployment returns the first of the named Deployments that exists in
+// namespace, or nil if none does. Only errors other than NotFound (e.g. RBAC
+// denials) are returned.
+func findDeployment(ctx context.Context, clientset kubernetes.Interface, namespace string, names ...string) (*appsv1.Deployment, error) {
+	for _, name := range names {
+		deploy, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return deploy, nil
+	}
+	return nil, nil
+}
+
+// detectServiceMesh reports "istio", "linkerd", "none", or "unknown" when the
+// control plane cannot be looked up.
+func detectServiceMesh(ctx context.Context, clientset kubernetes.Interface) string {
+	meshes := []struct {
+		name        string
+		namespace   string
+		deployments []string
+	}{
+		{"istio", "istio-system", []string{"istiod"}},
+		{"linkerd", "linkerd", []string{"linkerd-destination", "linkerd-controller"}},
+	}
+
+	for _, mesh := range meshes {
+		deploy, err := findDeployment(ctx, clientset, mesh.namespace, mesh.deployments...)
+		if err != nil {
+			logrus.WithField("mesh", mesh.name).WithError(err).Warn("failed to detect service mesh")
+			return "unknown"
+		}
+		if deploy != nil {
+			return mesh.name
+		}
+	}
+	return "none"
+}
+
+// loadBalancerProviders match the DaemonSets of in-cluster LoadBalancer
+// implementations by namespace or name prefix. ServiceLB (klipper-lb), built
+// into RKE2 and K3s, runs one svclb-<service> DaemonSet per exposed Service.
+var loadBalancerProviders = []struct {
+	name      string
+	namespace string
+	prefix    string
+}{
+	{"metallb", "metallb-system", "metallb"},
+	{"kube-vip", "", "kube-vip"},
+	{"servicelb", "", "svclb-"},
+}
+
+// detectLoadBalancerProvider reports the in-cluster LoadBalancer
+// implementation, "none" if no known one runs (e.g. when a cloud provider
+// fulfills LoadBalancer Services), or "unknown" if DaemonSets cannot be
+// listed.
+func detectLoadBalancerProvider(ctx context.Context, clientset kubernetes.Interface) string {
+	found := make(map[string]bool)
+	err := paginate(func(opts metav1.ListOptions) (string, error) {
+		list, err := clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, ds := range list.Items {
+			for _, p := range loadBalancerProviders {
+				if (p.namespace != "" && ds.Namespace == p.namespace) || strings.HasPrefix(ds.Name, p.prefix) {
+					found[p.name] = true
+				}
+			}
+		}
+		return list.Continue, nil
+	})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list daemonsets for load balancer detection")
+		return "unknown"
+	}
+	for _, p := range loadBalancerProviders {
+		if found[p.name] {
+			return p.name
+		}
+	}
+	return "none"
+}
+
+// detectCertManager reports whether the cert-manager controller is deployed
+// and its image tag, or "unknown" when the tag cannot be read. The error is
+// returned when the lookup itself fails, e.g. on RBAC denial.
+func detectCertManager(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	deploy, err := findDeployment(ctx, clientset, "cert-manager", "cert-manager")
+	if err != nil {
+		return nil, err
+	}
+	if deploy == nil {
+		return map[string]interface{}{"installed": false}, nil
+	}
+	version := ""
+	if containers := deploy.Spec.Template.Spec.Containers; len(containers) > 0 {
+		version = extractImageVersion(containers[0].Image)
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	return map[string]interface{}{"installed": true, "version": version}, nil
+}
+
+// metricsServerDeployments are the metrics-server Deployment names in
+// kube-system: RKE2 ships it as rke2-metrics-server, the upstream manifests
+// and Helm chart as metrics-server.
+var metricsServerDeployments = []string{"rke2-metrics-server", "metrics-server"}
+
+// detectMetricsServer reports whether metrics-server is deployed in
+// kube-system and, if so, whether any replica is available. The error is
+// returned when the lookup itself fails, e.g. on RBAC denial.
+func detectMetricsServer(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	deploy, err := findDeployment(ctx, clientset, metav1.NamespaceSystem, metricsServerDeployments...)
+	if err != nil {
+		return nil, err
+	}
+	if deploy == nil {
+		return map[string]interface{}{"installed": false}, nil
+	}
+	return map[string]interface{}{"installed": true, "ready": deploy.Status.AvailableReplicas > 0}, nil
+}
+
+// dashboardDeployments are the Kubernetes Dashboard Deployments by namespace:
+// the Helm chart (v7+) splits the web UI out of the single v2 Deployment, and
+// older manifests installed the dashboard into kube-system.
+var dashboardDeployments = []struct {
+	namespace string
+	names     []string
+}{
+	{"kubernetes-dashboard", []string{"kubernetes-dashboard", "kubernetes-dashboard-web"}},
+	{"kube-system", []string{"kubernetes-dashboard"}},
+}
+
+// detectDashboard reports "dashboardInstalled" and, when the Kubernetes
+// Dashboard is deployed and its image tag can be read, "dashboardVersion".
+// The error is returned when the lookup itself fails, e.g. on RBAC denial.
+func detectDashboard(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	for _, d := range dashboardDeployments {
+		deploy, err := findDeployment(ctx, clientset, d.namespace, d.names...)
+		if err != nil {
+			return nil, err
+		}
+		if deploy == nil {
+			continue
+		}
+		fields := map[string]interface{}{"dashboardInstalled": true}
+		if containers := deploy.Spec.Template.Spec.Containers; len(containers) > 0 {
+			if version := extractImageVersion(containers[0].Image); version != "" {
+				fields["dashboardVersion"] = version
+			}
+		}
+		return fields, nil
+	}
+	return map[string]interface{}{"dashboardInstalled": false}, nil
+}
+
+// policyEngines are the admission policy engines by their controller
+// Deployments. Kyverno 1.10+ charts name the admission controller
+// kyverno-admission-controller; older releases a single kyverno Deployment.
+var policyEngines = []struct {
+	name        string
+	namespace   string
+	deployments []string
+}{
+	{"gatekeeper", "gatekeeper-system", []string{"gatekeeper-controller-manager"}},
+	{"kyverno", "kyverno", []string{"kyverno-admission-controller", "kyverno"}},
+}
+
+// detectPolicyEngines reports "policyEngine", the engine in use
+// ("gatekeeper", "kyverno", "both", or "none"), and "policyEngineVersions",
+// the image tag of each engine found where it can be read. The error is
+// returned when a lookup itself fails, e.g. on RBAC denial.
+func detectPolicyEngines(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	versions := make(map[string]string)
+	var found []string
+	for _, e := range policyEngines {
+		deploy, err := findDeployment(ctx, clientset, e.namespace, e.deployments...)
+		if err != nil {
+			return nil, err
+		}
+		if deploy == nil {
+			continue
+		}
+		found = append(found, e.name)
+		if containers := deploy.Spec.Template.Spec.Containers; len(containers) > 0 {
+			if version := extractImageVersion(containers[0].Image); version != "" {
+				versions[e.name] = version
+			}
+		}
+	}
+	engine := "both"
+	switch len(found) {
+	case 0:
+		engine = "none"
+	case 1:
+		engine = found[0]
+	}
+	return map[string]interface{}{"policyEngine": engine, "policyEngineVersions": versions}, nil
+}
+
+// backupTools are the backup operators by their Deployments, in the order
+// preferred for backupTool when several are installed.
+var backupTools = []struct {
+	name       string
+	versionKey string
+	namespace  string
+	deployment string
+}{
+	{"velero", "veleroVersion", "velero", "velero"},
+	{"kasten", "kastenVersion", "kasten-io", "catalog-svc"},
+	{"rancher-backup", "rancherBackupVersion", "cattle-resources-system", "rancher-backup"},
+}
+
+// detectBackupTools reports "backupTool", the first operator found in
+// backupTools order or "none", "backupTools", all of those found, and the
+// image tag of each under its version key where it can be read. The error is
+// returned when a lookup itself fails, e.g. on RBAC denial.
+func detectBackupTools(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	tools := []string{}
+	fields := map[string]interface{}{"backupTool": "none"}
+	for _, b := range backupTools {
+		deploy, err := findDeployment(ctx, clientset, b.namespace, b.deployment)
+		if err != nil {
+			return nil, err
+		}
+		if deploy == nil {
+			continue
+		}
+		tools = append(tools, b.name)
+		if containers := deploy.Spec.Template.Spec.Containers; len(containers) > 0 {
+			if version := extractImageVersion(containers[0].Image); version != "" {
+				fields[b.versionKey] = version
+			}
+		}
+	}
+	if len(tools) > 0 {
+		fields["backupTool"] = tools[0]
+	}
+	fields["backupTools"] = tools
+	return fields, nil
+}
+
+// countWebhookConfigurations returns the number of validating and mutating
+// admission webhook configurations.
+func countWebhookConfigurations(ctx context.Context, clientset kubernetes.Interface) (validating, mutating int, err error) {
+	api := clientset.AdmissionregistrationV1()
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		list, err := api.ValidatingWebhookConfigurations().List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		validating += len(list.Items)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		list, err := api.MutatingWebhookConfigurations().List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		mutating += len(list.Items)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return validating, mutating, nil
+}
+
+// defaultStorageClassAnnotations mark a StorageClass as the cluster default;
+// the beta annotation is still honored by the API server.
+var defaultStorageClassAnnotations = []string{
+	"storageclass.kubernetes.io/is-default-class",
+	"storageclass.beta.kubernetes.io/is-default-class",
+}
+
+// detectDefaultStorageClass reports the name and provisioner of the default
+// StorageClass, or the name "none" when there is none. Several defaults are a
+// misconfiguration: the API server then uses the newest, which is reported
+// with "multipleDefaults" set. The error is returned when the list fails,
+// e.g. on RBAC denial.
+func detectDefaultStorageClass(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	list, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var defaults []storagev1.StorageClass
+	for _, sc := range list.Items {
+		for _, annotation := range defaultStorageClassAnnotations {
+			if sc.Annotations[annotation] == "true" {
+				defaults = append(defaults, sc)
+				break
+			}
+		}
+	}
+	if len(defaults) == 0 {
+		return map[string]interface{}{"name": "none"}, nil
+	}
+	// Newest first, then by name so that the result is stable.
+	sort.Slice(defaults, func(i, j int) bool {
+		ti, tj := defaults[i].CreationTimestamp, defaults[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return defaults[i].Name < defaults[j].Name
+	})
+	result := map[string]interface{}{
+		"name":        defaults[0].Name,
+		"provisioner": defaults[0].Provisioner,
+	}
+	if len(defaults) > 1 {
+		result["multipleDefaults"] = true
+	}
+	return result, nil
+}
+
+// detectCSIDrivers returns the sorted names of the registered CSIDriver
+// objects, or "unknown" when they cannot be listed.
+func detectCSIDrivers(ctx context.Context, clientset kubernetes.Interface) interface{} {
+	list, err := clientset.StorageV1().CSIDrivers().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to detect CSI drivers")
+		return "unknown"
+	}
+	drivers := make([]string, 0, len(list.Items))
+	for _, driver := range list.Items {
+		drivers = append(drivers, driver.Name)
+	}
+	sort.Strings(drivers)
+	return drivers
+}
+
+// detectCISProfile reports whether the cluster runs the RKE2 CIS profile and,
+// if a server node records it, the profile value (e.g. "cis" or "cis-1.23").
+// RKE2 records the server arguments in the rke2.io/node-args annotation and
+// creates default-network-policy in kube-system when a profile is set.
+func detectCISProfile(ctx context.Context, clientset kubernetes.Interface) (bool, string) {
+	profile := ""
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: "node-role.kubernetes.io/control-plane=true",
+		Limit:         1,
+	})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list server nodes for CIS profile")
+	} else if len(nodes.Items) > 0 {
+		profile = profileFromNodeArgs(nodes.Items[0].Annotations["rke2.io/node-args"])
+	}
+	if profile != "" {
+		return true, profile
+	}
+
+	_, err = clientset.NetworkingV1().NetworkPolicies("kube-system").Get(ctx, "default-network-policy", metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return true, ""
+	case !apierrors.IsNotFound(err):
+		logrus.WithError(err).Warn("failed to look up kube-system network policy for CIS profile")
+	}
+	return false, ""
+}
+
+// profileFromNodeArgs returns the --profile value from a rke2.io/node-args
+// annotation, which is a JSON array of command-line arguments.
+func profileFromNodeArgs(annotation string) string {
+	args := parseNodeArgs(annotation)
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--profile="); ok {
+			return value
+		}
+		if arg == "--profile" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// parseNodeArgs decodes a rke2.io/node-args annotation, a JSON array of the
+// server's command-line arguments.
+func parseNodeArgs(annotation string) []string {
+	if annotation == "" {
+		return nil
+	}
+	var args []string
+	if err := json.Unmarshal([]byte(annotation), &args); err != nil {
+		logrus.WithError(err).Debug("failed to parse rke2.io/node-args")
+		return nil
+	}
+	return args
+}
+
+// Audit logging states reported by detectAuditLogging.
+const (
+	auditEnabled  = "enabled"
+	auditDisabled = "disabled"
+	auditUnknown  = "unknown"
+)
+
+// detectAuditLogging makes a best-effort guess at whether the API server
+// writes audit logs, since its flags cannot be read directly. In order:
+//   - the kube-apiserver static pod's mirror pod in kube-system, whose
+//     command line shows --audit-log-path or --audit-webhook-config-file;
+//   - an audit flag in a server node's rke2.io/node-args annotation;
+//   - an audit-policy ConfigMap in kube-system.
+//
+// Only the first signal can report "disabled"; otherwise it is "unknown".
+func detectAuditLogging(ctx context.Context, clientset kubernetes.Interface) string {
+	pods, err := clientset.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{
+		LabelSelector: "component=kube-apiserver",
+		Limit:         1,
+	})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list kube-apiserver pods for audit logging")
+	} else if len(pods.Items) > 0 {
+		for _, container := range pods.Items[0].Spec.Containers {
+			if container.Name == "kube-apiserver" {
+				if hasAuditFlag(append(container.Command, container.Args...), apiserverAuditFlags) {
+					return auditEnabled
+				}
+				return auditDisabled
+			}
+		}
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: "node-role.kubernetes.io/control-plane=true",
+		Limit:         1,
+	})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list server nodes for audit logging")
+	} else if len(nodes.Items) > 0 && hasAuditFlag(parseNodeArgs(nodes.Items[0].Annotations["rke2.io/node-args"]), rke2AuditFlags) {
+		return auditEnabled
+	}
+
+	_, err = clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "audit-policy", metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return auditEnabled
+	case !apierrors.IsNotFound(err):
+		logrus.WithError(err).Warn("failed to look up audit-policy ConfigMap")
+	}
+	return auditUnknown
+}
+
+// countPrivateRegistrySecrets counts the kubernetes.io/dockerconfigjson
+// Secrets in all namespaces. Only object metadata is listed, so Secret data
+// never reaches the responder. RBAC denials are returned, since the chart
+// grants access to Secrets only when opted in.
+func countPrivateRegistrySecrets(ctx context.Context, client metadata.Interface) (int, error) {
+	secrets := client.Resource(corev1.SchemeGroupVersion.WithResource("secrets")).Namespace(metav1.NamespaceAll)
+	selector := fields.OneTermEqualSelector("type", string(corev1.SecretTypeDockerConfigJson)).String()
+	count := 0
+	err := paginate(func(opts metav1.ListOptions) (string, error) {
+		opts.FieldSelector = selector
+		list, err := secrets.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		count += len(list.Items)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// detectLocalRegistryHosting reports whether the kube-public
+// local-registry-hosting ConfigMap (KEP-1755), which advertises a cluster
+// registry or mirror to tooling, exists.
+func detectLocalRegistryHosting(ctx context.Context, clientset kubernetes.Interface) (bool, error) {
+	_, err := clientset.CoreV1().ConfigMaps(metav1.NamespacePublic).Get(ctx, "local-registry-hosting", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// apiserverAuditFlags are the kube-apiserver flags that enable an audit
+// backend. A policy file alone does not.
+var apiserverAuditFlags = []string{"audit-log-path=", "audit-webhook-config-file="}
+
+// rke2AuditFlags also match RKE2 server arguments, which pass apiserver
+// flags through --kube-apiserver-arg or set --audit-policy-file.
+var rke2AuditFlags = append([]string{"audit-policy-file"}, apiserverAuditFlags...)
+
+// hasAuditFlag reports whether any of args, with leading dashes removed,
+// starts with one of flags.
+func hasAuditFlag(args, flags []string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		for _, flag := range flags {
+			if strings.HasPrefix(arg, flag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countCRDs returns the number of CustomResourceDefinitions and how many
+// belong to each API group.
+func countCRDs(ctx context.Context, clientset apiextensionsclientset.Interface) (total int, groups map[string]int, err error) {
+	groups = make(map[string]int)
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		list, err := clientset.ApiextensionsV1().CustomResourceDefinitions().List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, crd := range list.Items {
+			total++
+			groups[crd.Spec.Group]++
+		}
+		return list.Continue, nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, groups, nil
+}
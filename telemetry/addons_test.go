@@ -0,0 +1,860 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// forbidden makes every matching request fail as an RBAC denial would.
+func forbidden(clientset k8stesting.FakeClient, verb, resource string) {
+	clientset.PrependReactor(verb, resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: resource}, "", errors.New("denied"))
+	})
+}
+
+// metadataClient returns a fake metadata client serving objects, which are
+// built with objectMetadata.
+func metadataClient(objects ...runtime.Object) *metadatafake.FakeMetadataClient {
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func objectMetadata(kind, namespace, name string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+}
+
+func deployment(namespace, name, image string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: image}}},
+			},
+		},
+	}
+}
+
+func TestDetectServiceMesh(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		denied   bool
+		expected string
+	}{
+		{"none", nil, false, "none"},
+		{"istio", []runtime.Object{deployment("istio-system", "istiod", "istio/pilot:1.20.0")}, false, "istio"},
+		{"linkerd", []runtime.Object{deployment("linkerd", "linkerd-destination", "cr.l5d.io/linkerd/controller:stable-2.14.0")}, false, "linkerd"},
+		{"legacy linkerd", []runtime.Object{deployment("linkerd", "linkerd-controller", "gcr.io/linkerd-io/controller:stable-2.8.1")}, false, "linkerd"},
+		{"rbac denied", nil, true, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.denied {
+				forbidden(clientset, "get", "deployments")
+			}
+			if got := detectServiceMesh(context.Background(), clientset); got != tt.expected {
+				t.Errorf("detectServiceMesh() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectCSIDrivers(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		expected  interface{}
+	}{
+		{
+			name:     "none",
+			expected: []string{},
+		},
+		{
+			name: "sorted",
+			objects: []runtime.Object{
+				&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph.rbd.csi.ceph.com"}},
+				&storagev1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "driver.longhorn.io"}},
+			},
+			expected: []string{"driver.longhorn.io", "rook-ceph.rbd.csi.ceph.com"},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			expected:  "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "list", "csidrivers")
+			}
+			result := detectCSIDrivers(context.Background(), clientset)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("detectCSIDrivers() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectDefaultStorageClass(t *testing.T) {
+	storageClass := func(name, provisioner string, created time.Time, annotations map[string]string) *storagev1.StorageClass {
+		return &storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: name, Annotations: annotations, CreationTimestamp: metav1.NewTime(created)},
+			Provisioner: provisioner,
+		}
+	}
+	isDefault := map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		expected  map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name:     "no storage classes",
+			expected: map[string]interface{}{"name": "none"},
+		},
+		{
+			name: "no default",
+			objects: []runtime.Object{
+				storageClass("longhorn", "driver.longhorn.io", older, nil),
+				storageClass("not-default", "driver.longhorn.io", older, map[string]string{"storageclass.kubernetes.io/is-default-class": "false"}),
+			},
+			expected: map[string]interface{}{"name": "none"},
+		},
+		{
+			name: "single default",
+			objects: []runtime.Object{
+				storageClass("longhorn", "driver.longhorn.io", older, nil),
+				storageClass("local-path", "rancher.io/local-path", older, isDefault),
+			},
+			expected: map[string]interface{}{"name": "local-path", "provisioner": "rancher.io/local-path"},
+		},
+		{
+			name: "beta annotation",
+			objects: []runtime.Object{
+				storageClass("local-path", "rancher.io/local-path", older, map[string]string{"storageclass.beta.kubernetes.io/is-default-class": "true"}),
+			},
+			expected: map[string]interface{}{"name": "local-path", "provisioner": "rancher.io/local-path"},
+		},
+		{
+			name: "multiple defaults report the newest",
+			objects: []runtime.Object{
+				storageClass("local-path", "rancher.io/local-path", older, isDefault),
+				storageClass("longhorn", "driver.longhorn.io", newer, isDefault),
+			},
+			expected: map[string]interface{}{"name": "longhorn", "provisioner": "driver.longhorn.io", "multipleDefaults": true},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "list", "storageclasses")
+			}
+			result, err := detectDefaultStorageClass(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectDefaultStorageClass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("detectDefaultStorageClass() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectCISProfile(t *testing.T) {
+	server := func(nodeArgs string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "server-1",
+			Labels:      map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+			Annotations: map[string]string{"rke2.io/node-args": nodeArgs},
+		}}
+	}
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-network-policy", Namespace: "kube-system"},
+	}
+
+	tests := []struct {
+		name         string
+		objects      []runtime.Object
+		forbidden    bool
+		wantHardened bool
+		wantProfile  string
+	}{
+		{
+			name:    "not hardened",
+			objects: []runtime.Object{server(`["server","--write-kubeconfig-mode","0644"]`)},
+		},
+		{
+			name:         "profile flag",
+			objects:      []runtime.Object{server(`["server","--profile","cis"]`)},
+			wantHardened: true,
+			wantProfile:  "cis",
+		},
+		{
+			name:         "profile flag with equals",
+			objects:      []runtime.Object{server(`["server","--profile=cis-1.23"]`)},
+			wantHardened: true,
+			wantProfile:  "cis-1.23",
+		},
+		{
+			name:         "network policy only",
+			objects:      []runtime.Object{networkPolicy},
+			wantHardened: true,
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "list", "nodes")
+				forbidden(clientset, "get", "networkpolicies")
+			}
+			hardened, profile := detectCISProfile(context.Background(), clientset)
+			if hardened != tt.wantHardened || profile != tt.wantProfile {
+				t.Errorf("detectCISProfile() = (%v, %q), want (%v, %q)", hardened, profile, tt.wantHardened, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestDetectCertManager(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name: "absent",
+			want: map[string]interface{}{"installed": false},
+		},
+		{
+			name:    "installed",
+			objects: []runtime.Object{deployment("cert-manager", "cert-manager", "quay.io/jetstack/cert-manager-controller:v1.16.2")},
+			want:    map[string]interface{}{"installed": true, "version": "v1.16.2"},
+		},
+		{
+			name:    "untagged image",
+			objects: []runtime.Object{deployment("cert-manager", "cert-manager", "cert-manager-controller")},
+			want:    map[string]interface{}{"installed": true, "version": "unknown"},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "deployments")
+			}
+			got, err := detectCertManager(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectCertManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectCertManager() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectMetricsServer(t *testing.T) {
+	available := func(d *appsv1.Deployment, replicas int32) *appsv1.Deployment {
+		d.Status.AvailableReplicas = replicas
+		return d
+	}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name: "absent",
+			want: map[string]interface{}{"installed": false},
+		},
+		{
+			name:    "rke2 ready",
+			objects: []runtime.Object{available(deployment("kube-system", "rke2-metrics-server", "rancher/hardened-k8s-metrics-server:v0.7.2"), 1)},
+			want:    map[string]interface{}{"installed": true, "ready": true},
+		},
+		{
+			name:    "upstream unavailable",
+			objects: []runtime.Object{available(deployment("kube-system", "metrics-server", "registry.k8s.io/metrics-server/metrics-server:v0.7.2"), 0)},
+			want:    map[string]interface{}{"installed": true, "ready": false},
+		},
+		{
+			name:    "other namespace",
+			objects: []runtime.Object{available(deployment("monitoring", "metrics-server", "metrics-server"), 1)},
+			want:    map[string]interface{}{"installed": false},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "deployments")
+			}
+			got, err := detectMetricsServer(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectMetricsServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectMetricsServer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectDashboard(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name: "absent",
+			want: map[string]interface{}{"dashboardInstalled": false},
+		},
+		{
+			name:    "v2 manifest",
+			objects: []runtime.Object{deployment("kubernetes-dashboard", "kubernetes-dashboard", "kubernetesui/dashboard:v2.7.0")},
+			want:    map[string]interface{}{"dashboardInstalled": true, "dashboardVersion": "v2.7.0"},
+		},
+		{
+			name:    "helm chart",
+			objects: []runtime.Object{deployment("kubernetes-dashboard", "kubernetes-dashboard-web", "docker.io/kubernetesui/dashboard-web:1.6.0")},
+			want:    map[string]interface{}{"dashboardInstalled": true, "dashboardVersion": "1.6.0"},
+		},
+		{
+			name:    "legacy kube-system install",
+			objects: []runtime.Object{deployment("kube-system", "kubernetes-dashboard", "kubernetesui/dashboard")},
+			want:    map[string]interface{}{"dashboardInstalled": true},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "deployments")
+			}
+			got, err := detectDashboard(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectDashboard() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectDashboard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectPolicyEngines(t *testing.T) {
+	gatekeeper := deployment("gatekeeper-system", "gatekeeper-controller-manager", "openpolicyagent/gatekeeper:v3.17.1")
+	kyverno := deployment("kyverno", "kyverno-admission-controller", "ghcr.io/kyverno/kyverno:v1.13.2")
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name: "none",
+			want: map[string]interface{}{"policyEngine": "none", "policyEngineVersions": map[string]string{}},
+		},
+		{
+			name:    "gatekeeper",
+			objects: []runtime.Object{gatekeeper},
+			want:    map[string]interface{}{"policyEngine": "gatekeeper", "policyEngineVersions": map[string]string{"gatekeeper": "v3.17.1"}},
+		},
+		{
+			name:    "legacy kyverno",
+			objects: []runtime.Object{deployment("kyverno", "kyverno", "ghcr.io/kyverno/kyverno:v1.9.5")},
+			want:    map[string]interface{}{"policyEngine": "kyverno", "policyEngineVersions": map[string]string{"kyverno": "v1.9.5"}},
+		},
+		{
+			name:    "both",
+			objects: []runtime.Object{gatekeeper, kyverno},
+			want:    map[string]interface{}{"policyEngine": "both", "policyEngineVersions": map[string]string{"gatekeeper": "v3.17.1", "kyverno": "v1.13.2"}},
+		},
+		{
+			name:    "untagged image",
+			objects: []runtime.Object{deployment("kyverno", "kyverno", "kyverno")},
+			want:    map[string]interface{}{"policyEngine": "kyverno", "policyEngineVersions": map[string]string{}},
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "deployments")
+			}
+			got, err := detectPolicyEngines(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectPolicyEngines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectPolicyEngines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountWebhookConfigurations(t *testing.T) {
+	objects := []runtime.Object{
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "rke2-ingress-nginx-admission"}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "cert-manager-webhook"}},
+		&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "cert-manager-webhook"}},
+	}
+
+	tests := []struct {
+		name           string
+		denied         string
+		wantValidating int
+		wantMutating   int
+		wantErr        bool
+	}{
+		{name: "counts", wantValidating: 2, wantMutating: 1},
+		{name: "validating forbidden", denied: "validatingwebhookconfigurations", wantErr: true},
+		{name: "mutating forbidden", denied: "mutatingwebhookconfigurations", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(objects...)
+			if tt.denied != "" {
+				forbidden(clientset, "list", tt.denied)
+			}
+			validating, mutating, err := countWebhookConfigurations(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countWebhookConfigurations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if validating != tt.wantValidating || mutating != tt.wantMutating {
+				t.Errorf("countWebhookConfigurations() = (%d, %d), want (%d, %d)", validating, mutating, tt.wantValidating, tt.wantMutating)
+			}
+		})
+	}
+}
+
+func crd(plural, group string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: plural + "." + group},
+		Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Group: group},
+	}
+}
+
+func TestCollect_CRDs(t *testing.T) {
+	crds := []runtime.Object{
+		crd("certificates", "cert-manager.io"),
+		crd("issuers", "cert-manager.io"),
+		crd("helmcharts", "helm.cattle.io"),
+	}
+
+	tests := []struct {
+		mode       string
+		denied     bool
+		wantCount  interface{}
+		wantGroups interface{}
+	}{
+		{"recommended", false, 3, map[string]int{"cert-manager.io": 2, "helm.cattle.io": 1}},
+		{"minimal", false, -1, map[string]int{"cert-manager.io": -1, "helm.cattle.io": -1}},
+		{"recommended", true, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+			extensions := apiextensionsfake.NewClientset(crds...)
+			if tt.denied {
+				extensions.PrependReactor("list", "customresourcedefinitions", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "customresourcedefinitions"}, "", errors.New("denied"))
+				})
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode, Extensions: extensions})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["crdCount"] != tt.wantCount {
+				t.Errorf("crdCount = %v, want %v", data.ExtraFieldInfo["crdCount"], tt.wantCount)
+			}
+			if got := data.ExtraFieldInfo["crdGroups"]; !reflect.DeepEqual(got, tt.wantGroups) {
+				t.Errorf("crdGroups = %v, want %v", got, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestDetectAuditLogging(t *testing.T) {
+	apiserver := func(args ...string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kube-apiserver-server-1",
+				Namespace: "kube-system",
+				Labels:    map[string]string{"component": "kube-apiserver"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:    "kube-apiserver",
+				Command: []string{"kube-apiserver"},
+				Args:    args,
+			}}},
+		}
+	}
+	server := func(nodeArgs string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "server-1",
+			Labels:      map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+			Annotations: map[string]string{"rke2.io/node-args": nodeArgs},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		denied  string
+		want    string
+	}{
+		{
+			name:    "apiserver log path",
+			objects: []runtime.Object{apiserver("--audit-policy-file=/etc/audit.yaml", "--audit-log-path=/var/log/audit.log")},
+			want:    "enabled",
+		},
+		{
+			name:    "apiserver webhook",
+			objects: []runtime.Object{apiserver("--audit-webhook-config-file=/etc/webhook.yaml")},
+			want:    "enabled",
+		},
+		{
+			name:    "apiserver policy only",
+			objects: []runtime.Object{apiserver("--audit-policy-file=/etc/audit.yaml")},
+			want:    "disabled",
+		},
+		{
+			name:    "node args",
+			objects: []runtime.Object{server(`["server","--kube-apiserver-arg","audit-log-path=/var/log/audit.log"]`)},
+			want:    "enabled",
+		},
+		{
+			name:    "node args policy file",
+			objects: []runtime.Object{server(`["server","--audit-policy-file","/etc/rancher/rke2/audit.yaml"]`)},
+			want:    "enabled",
+		},
+		{
+			name:    "configmap",
+			objects: []runtime.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "audit-policy", Namespace: "kube-system"}}},
+			want:    "enabled",
+		},
+		{
+			name:    "pods forbidden",
+			objects: []runtime.Object{apiserver(), server(`["server"]`)},
+			denied:  "pods",
+			want:    "unknown",
+		},
+		{
+			name: "no signals",
+			want: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.denied != "" {
+				forbidden(clientset, "list", tt.denied)
+			}
+			if got := detectAuditLogging(context.Background(), clientset); got != tt.want {
+				t.Errorf("detectAuditLogging() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountPrivateRegistrySecrets(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      int
+		wantErr   bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "pull secrets across namespaces",
+			objects: []runtime.Object{
+				objectMetadata("Secret", "default", "registry"),
+				objectMetadata("Secret", "apps", "registry"),
+			},
+			want: 2,
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := metadataClient(tt.objects...)
+			if tt.forbidden {
+				forbidden(client, "list", "secrets")
+			}
+			got, err := countPrivateRegistrySecrets(context.Background(), client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countPrivateRegistrySecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("countPrivateRegistrySecrets() = %d, want %d", got, tt.want)
+			}
+			// The fake client does not filter by field, so check the
+			// selector that limits the list to pull secrets.
+			for _, action := range client.Actions() {
+				list, ok := action.(k8stesting.ListAction)
+				if !ok {
+					continue
+				}
+				if selector := list.GetListRestrictions().Fields.String(); selector != "type=kubernetes.io/dockerconfigjson" {
+					t.Errorf("field selector = %q, want type=kubernetes.io/dockerconfigjson", selector)
+				}
+			}
+		})
+	}
+}
+
+func TestCollect_PrivateRegistrySecrets(t *testing.T) {
+	tests := []struct {
+		mode   string
+		denied bool
+		want   interface{}
+	}{
+		{"recommended", false, 1},
+		{"minimal", false, -1},
+		{"recommended", true, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+			client := metadataClient(objectMetadata("Secret", "default", "registry"))
+			if tt.denied {
+				forbidden(client, "list", "secrets")
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode, Metadata: client})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if got := data.ExtraFieldInfo["privateRegistrySecretCount"]; got != tt.want {
+				t.Errorf("privateRegistrySecretCount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLocalRegistryHosting(t *testing.T) {
+	hosting := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "local-registry-hosting", Namespace: "kube-public"}}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      bool
+		wantErr   bool
+	}{
+		{name: "absent"},
+		{name: "present", objects: []runtime.Object{hosting}, want: true},
+		{name: "forbidden", objects: []runtime.Object{hosting}, forbidden: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "configmaps")
+			}
+			got, err := detectLocalRegistryHosting(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectLocalRegistryHosting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("detectLocalRegistryHosting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLoadBalancerProvider(t *testing.T) {
+	daemonSet := func(namespace, name string) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      string
+	}{
+		{"none", []runtime.Object{daemonSet("kube-system", "rke2-canal")}, false, "none"},
+		{"metallb manifest", []runtime.Object{daemonSet("metallb-system", "speaker")}, false, "metallb"},
+		{"metallb chart", []runtime.Object{daemonSet("networking", "metallb-speaker")}, false, "metallb"},
+		{"kube-vip", []runtime.Object{daemonSet("kube-system", "kube-vip-ds")}, false, "kube-vip"},
+		{"servicelb", []runtime.Object{daemonSet("kube-system", "svclb-traefik-5d7c3f1a")}, false, "servicelb"},
+		{"metallb preferred", []runtime.Object{daemonSet("kube-system", "svclb-web-1a2b3c4d"), daemonSet("metallb-system", "speaker")}, false, "metallb"},
+		{"forbidden", nil, true, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "list", "daemonsets")
+			}
+			if got := detectLoadBalancerProvider(context.Background(), clientset); got != tt.want {
+				t.Errorf("detectLoadBalancerProvider() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectBackupTools(t *testing.T) {
+	velero := deployment("velero", "velero", "velero/velero:v1.15.2")
+	kasten := deployment("kasten-io", "catalog-svc", "gcr.io/kasten-images/catalog:7.5.1")
+	rancherBackup := deployment("cattle-resources-system", "rancher-backup", "rancher/backup-restore-operator:v6.1.0")
+	none := map[string]interface{}{"backupTool": "none", "backupTools": []string{}}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		forbidden bool
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name: "none",
+			want: none,
+		},
+		{
+			name:    "velero",
+			objects: []runtime.Object{velero},
+			want: map[string]interface{}{
+				"backupTool":    "velero",
+				"backupTools":   []string{"velero"},
+				"veleroVersion": "v1.15.2",
+			},
+		},
+		{
+			name:    "several",
+			objects: []runtime.Object{rancherBackup, kasten},
+			want: map[string]interface{}{
+				"backupTool":           "kasten",
+				"backupTools":          []string{"kasten", "rancher-backup"},
+				"kastenVersion":        "7.5.1",
+				"rancherBackupVersion": "v6.1.0",
+			},
+		},
+		{
+			name:    "other namespace",
+			objects: []runtime.Object{deployment("backup", "velero", "velero/velero:v1.15.2")},
+			want:    none,
+		},
+		{
+			name:      "forbidden",
+			forbidden: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "get", "deployments")
+			}
+			got, err := detectBackupTools(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectBackupTools() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectBackupTools() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package telemetry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Circuit breaker states, as exported by security_responder_circuit_breaker_state.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// ErrCircuitOpen is returned by SendAll for an endpoint skipped because its
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker stops delivering to an endpoint for a cooldown once it has
+// failed in threshold consecutive cycles, so that a long outage does not cost
+// a full round of retries and warnings every cycle. After the cooldown the
+// next delivery is a probe (half-open): success closes the breaker, failure
+// opens it again. It is safe for concurrent use.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	endpoints map[string]*breakerEndpoint
+}
+
+type breakerEndpoint struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a breaker that opens after threshold consecutive
+// failures and probes again after cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		endpoints: make(map[string]*breakerEndpoint),
+	}
+}
+
+// allow reports whether a delivery to endpoint may be attempted and, if not,
+// how long until the breaker lets a probe through. A nil CircuitBreaker
+// allows every delivery.
+func (b *CircuitBreaker) allow(endpoint string) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.endpoints[endpoint]
+	if e == nil || e.state != breakerOpen {
+		return true, 0
+	}
+	if remaining := e.openedAt.Add(b.cooldown).Sub(b.now()); remaining > 0 {
+		return false, remaining
+	}
+	b.set(endpoint, e, breakerHalfOpen)
+	logrus.WithField("endpoint", endpoint).Info("circuit breaker half-open, probing endpoint")
+	return true, 0
+}
+
+// record updates the endpoint's breaker with the result of a delivery. A nil
+// CircuitBreaker records nothing.
+func (b *CircuitBreaker) record(endpoint string, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.endpoints[endpoint]
+	if e == nil {
+		e = &breakerEndpoint{}
+		b.endpoints[endpoint] = e
+	}
+	if err == nil {
+		if e.state != breakerClosed {
+			logrus.WithField("endpoint", endpoint).Info("circuit breaker closed, endpoint recovered")
+		}
+		e.failures = 0
+		b.set(endpoint, e, breakerClosed)
+		return
+	}
+	e.failures++
+	if e.state == breakerHalfOpen || e.failures >= b.threshold {
+		logrus.WithFields(logrus.Fields{"endpoint": endpoint, "failures": e.failures, "cooldown": b.cooldown}).Warn("circuit breaker open, skipping endpoint")
+		e.openedAt = b.now()
+		b.set(endpoint, e, breakerOpen)
+	}
+}
+
+func (b *CircuitBreaker) set(endpoint string, e *breakerEndpoint, state int) {
+	e.state = state
+	circuitBreakerState.WithLabelValues(endpoint).Set(float64(state))
+}
@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var down atomic.Bool
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	breaker := NewCircuitBreaker(2, time.Hour)
+	breaker.now = func() time.Time { return now }
+	opts := SendOptions{Breaker: breaker}
+	data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	// Each step is one cycle, advanced by the given time.
+	steps := []struct {
+		name      string
+		down      bool
+		advance   time.Duration
+		wantSent  bool
+		wantOpen  bool
+		wantState int
+	}{
+		{"healthy", false, 0, true, false, breakerClosed},
+		{"first failure", true, time.Minute, true, false, breakerClosed},
+		{"threshold reached", true, time.Minute, true, false, breakerOpen},
+		{"skipped while open", true, time.Minute, false, true, breakerOpen},
+		{"failed probe reopens", true, time.Hour, true, false, breakerOpen},
+		{"skipped after reopening", false, 30 * time.Minute, false, true, breakerOpen},
+		{"successful probe closes", false, time.Hour, true, false, breakerClosed},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		down.Store(step.down)
+		before := requests.Load()
+
+		err := SendAll(context.Background(), data, []string{server.URL}, opts, false)
+		if sent := requests.Load() > before; sent != step.wantSent {
+			t.Errorf("%s: sent = %v, want %v", step.name, sent, step.wantSent)
+		}
+		if open := errors.Is(err, ErrCircuitOpen); open != step.wantOpen {
+			t.Errorf("%s: SendAll() error = %v, want circuit open %v", step.name, err, step.wantOpen)
+		}
+		if got := breaker.endpoints[server.URL].state; got != step.wantState {
+			t.Errorf("%s: state = %d, want %d", step.name, got, step.wantState)
+		}
+	}
+
+	var none *CircuitBreaker
+	if ok, _ := none.allow(server.URL); !ok {
+		t.Error("nil allow() = false, want true")
+	}
+	none.record(server.URL, errors.New("failed"))
+}
@@ -0,0 +1,229 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ClientOptions configures the HTTP client used to deliver telemetry.
+type ClientOptions struct {
+	// Proxy overrides HTTP_PROXY and HTTPS_PROXY. NO_PROXY is still honored.
+	Proxy string
+	// CACert is a PEM bundle, or a path to one, trusted in addition to the
+	// system roots.
+	CACert string
+	// InsecureSkipVerify disables server certificate verification. Lab use only.
+	InsecureSkipVerify bool
+	// ClientCert and ClientKey are paths to a PEM key pair presented for
+	// mutual TLS. Both must be set together.
+	ClientCert string
+	ClientKey  string
+	// ConnectTimeout bounds establishing the TCP connection; zero keeps
+	// the transport default of 30s.
+	ConnectTimeout time.Duration
+	// Timeout bounds each request attempt, including reading the response;
+	// zero means 30s.
+	Timeout time.Duration
+}
+
+// NewClient builds the HTTP client used by Send. Proxy settings are validated
+// here so that a malformed value fails at startup rather than on every attempt.
+func NewClient(opts ClientOptions) (*http.Client, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if opts.Proxy != "" {
+		proxyConfig.HTTPProxy = opts.Proxy
+		proxyConfig.HTTPSProxy = opts.Proxy
+	}
+	for _, p := range []string{proxyConfig.HTTPProxy, proxyConfig.HTTPSProxy} {
+		if p == "" {
+			continue
+		}
+		if _, err := parseProxyURL(p); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if opts.ConnectTimeout > timeout {
+		return nil, fmt.Errorf("connect timeout %s exceeds total timeout %s", opts.ConnectTimeout, timeout)
+	}
+
+	// HTTPS requests through an HTTP proxy are tunnelled via CONNECT by the transport.
+	proxyFunc := proxyConfig.ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	if opts.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACert != "" {
+		pool, err := loadCertPool(opts.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (opts.ClientCert == "") != (opts.ClientKey == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if opts.ClientCert != "" {
+		// Loaded once here so retries reuse the same key pair.
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if opts.InsecureSkipVerify {
+		logrus.Warn("TLS certificate verification is DISABLED; do not use in production")
+		tlsConfig.InsecureSkipVerify = true // #nosec G402 -- explicit opt-in for lab environments
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// loadCertPool returns the system roots extended with the given PEM bundle,
+// which may be inline PEM or a file path.
+func loadCertPool(caCert string) (*x509.CertPool, error) {
+	pemData := []byte(caCert)
+	if !strings.Contains(caCert, "-----BEGIN") {
+		var err error
+		pemData, err = os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		logrus.WithError(err).Debug("system cert pool unavailable, using CA bundle only")
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("failed to parse CA bundle: no PEM certificates found")
+	}
+	return pool, nil
+}
+
+// ValidateEndpoint checks that endpoint is an absolute https URL, or http
+// when allowInsecure is set, or a unix URL naming an existing socket, so that
+// a bad value fails at startup.
+func ValidateEndpoint(endpoint string, allowInsecure bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	switch {
+	case u.Scheme == unixScheme:
+		// The socket never leaves the node, so plain HTTP is allowed.
+		return validateSocket(endpoint, u)
+	case u.Scheme == "https":
+	case u.Scheme == "http" && allowInsecure:
+	case u.Scheme == "http":
+		return fmt.Errorf("invalid endpoint %q: plain http requires SECURITY_RESPONDER_ALLOW_INSECURE=true", endpoint)
+	default:
+		return fmt.Errorf("invalid endpoint %q: scheme must be https", endpoint)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: missing host", endpoint)
+	}
+	return nil
+}
+
+// unixScheme marks endpoints such as unix:///run/collector.sock, which are
+// sent over HTTP on a Unix domain socket.
+const unixScheme = "unix"
+
+// unixSocketHost is the host of requests sent over a Unix domain socket.
+// Receivers see it in the Host header; it is never resolved.
+const unixSocketHost = "localhost"
+
+// socketPath returns the socket path of a unix endpoint, and false for other
+// endpoints.
+func socketPath(endpoint string) (string, bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != unixScheme {
+		return "", false
+	}
+	return u.Path, true
+}
+
+func validateSocket(endpoint string, u *url.URL) error {
+	if u.Host != "" || u.Path == "" {
+		return fmt.Errorf("invalid endpoint %q: want unix:///path/to/socket", endpoint)
+	}
+	info, err := os.Stat(u.Path)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("invalid endpoint %q: %s is not a socket", endpoint, u.Path)
+	}
+	return nil
+}
+
+// unixSocketClient returns a copy of client whose connections are made to
+// the socket at path instead of the request's host. The timeout and
+// transport settings are kept; proxies do not apply.
+func unixSocketClient(client *http.Client, path string) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.Proxy = nil
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	unixClient := *client
+	unixClient.Transport = transport
+	return &unixClient
+}
+
+// parseProxyURL validates a proxy URL. Like httpproxy, a bare host:port is
+// treated as an http:// proxy.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	raw := proxy
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		// The raw value may carry credentials, so only the cause is reported.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q", u.Redacted(), u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", u.Redacted())
+	}
+	return u, nil
+}
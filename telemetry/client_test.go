@@ -0,0 +1,344 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewClient_Proxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		proxy     string
+		noProxy   string
+		target    string
+		wantProxy string
+		wantErr   bool
+	}{
+		{"no proxy", "", "", "https://example.com", "", false},
+		{"override", "http://proxy.corp:3128", "", "https://example.com", "http://proxy.corp:3128", false},
+		{"bare host:port", "proxy.corp:3128", "", "https://example.com", "http://proxy.corp:3128", false},
+		{"no_proxy bypass", "http://proxy.corp:3128", ".svc.cluster.local", "http://mock.kube-system.svc.cluster.local", "", false},
+		{"unsupported scheme", "ftp://proxy.corp", "", "", "", true},
+		{"missing host", "http://", "", "", "", true},
+		{"malformed", "http://proxy.corp:port", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HTTP_PROXY", "")
+			t.Setenv("HTTPS_PROXY", "")
+			t.Setenv("NO_PROXY", tt.noProxy)
+
+			client, err := NewClient(ClientOptions{Proxy: tt.proxy})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewClient() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			req, _ := http.NewRequest(http.MethodPost, tt.target, nil)
+			proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+			if err != nil {
+				t.Fatalf("Proxy() error = %v", err)
+			}
+			got := ""
+			if proxyURL != nil {
+				got = proxyURL.String()
+			}
+			if got != tt.wantProxy {
+				t.Errorf("proxy = %q, want %q", got, tt.wantProxy)
+			}
+		})
+	}
+}
+
+func TestNewClient_EnvironmentProxy(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:8080")
+	t.Setenv("NO_PROXY", "")
+
+	client, err := NewClient(ClientOptions{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	if proxyURL == nil || proxyURL.String() != "http://env-proxy:8080" {
+		t.Errorf("proxy = %v, want http://env-proxy:8080", proxyURL)
+	}
+}
+
+func TestNewClient_CACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(caPEM), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(badFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       ClientOptions
+		wantErr    bool
+		wantVerify bool
+	}{
+		{"system roots only", ClientOptions{}, false, false},
+		{"inline PEM", ClientOptions{CACert: caPEM}, false, true},
+		{"PEM file", ClientOptions{CACert: caFile}, false, true},
+		{"insecure skip verify", ClientOptions{InsecureSkipVerify: true}, false, true},
+		{"missing file", ClientOptions{CACert: filepath.Join(t.TempDir(), "missing.pem")}, true, false},
+		{"unparseable file", ClientOptions{CACert: badFile}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewClient() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			resp, err := client.Get(server.URL)
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+			if tt.wantVerify && err != nil {
+				t.Errorf("request error = %v, want success", err)
+			}
+			if !tt.wantVerify && err == nil {
+				t.Error("request succeeded, want TLS verification error")
+			}
+		})
+	}
+}
+
+// writeKeyPair generates a self-signed client certificate and returns the
+// paths of its PEM-encoded certificate and key.
+func writeKeyPair(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "security-responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewClient_ClientCert(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t)
+
+	tests := []struct {
+		name    string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{"both set", certFile, keyFile, false},
+		{"cert only", certFile, "", true},
+		{"key only", "", keyFile, true},
+		{"missing files", filepath.Join(t.TempDir(), "x.crt"), filepath.Join(t.TempDir(), "x.key"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(ClientOptions{ClientCert: tt.cert, ClientKey: tt.key})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClient_Timeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		connect     time.Duration
+		total       time.Duration
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{"defaults", 0, 0, 30 * time.Second, false},
+		{"connect only", 5 * time.Second, 0, 30 * time.Second, false},
+		{"both set", 5 * time.Second, 2 * time.Minute, 2 * time.Minute, false},
+		{"connect exceeds total", time.Minute, 10 * time.Second, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(ClientOptions{ConnectTimeout: tt.connect, Timeout: tt.total})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if client.Timeout != tt.wantTimeout {
+				t.Errorf("Timeout = %v, want %v", client.Timeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestNewClient_MutualTLS(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewClient(ClientOptions{ClientCert: certFile, ClientKey: keyFile, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+// listenUnix listens on a Unix domain socket in a temporary directory.
+func listenUnix(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "collector.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+	return lis, path
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	_, socket := listenUnix(t)
+	regular := filepath.Join(t.TempDir(), "regular")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		endpoint      string
+		allowInsecure bool
+		wantErr       bool
+	}{
+		{"https", "https://security-responder.rke2.io/v1/check", false, false},
+		{"http rejected", "http://mock-responder.kube-system.svc:80", false, true},
+		{"http allowed", "http://mock-responder.kube-system.svc:80", true, false},
+		{"no scheme", "security-responder.rke2.io/v1/check", false, true},
+		{"other scheme", "ftp://security-responder.rke2.io", true, true},
+		{"missing host", "https:///v1/check", false, true},
+		{"not a URL", "://bad", false, true},
+		{"unix socket", "unix://" + socket, false, false},
+		{"missing socket", "unix:///nonexistent/collector.sock", false, true},
+		{"not a socket", "unix://" + regular, false, true},
+		{"unix with host", "unix://host" + socket, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpoint(tt.endpoint, tt.allowInsecure)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEndpoint(%q) error = %v, wantErr %v", tt.endpoint, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSend_UnixSocket(t *testing.T) {
+	lis, path := listenUnix(t)
+	var gotPath, gotHost string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotHost = r.URL.Path, r.Host
+		_, _ = w.Write([]byte(`{"requestIntervalInMinutes":60}`))
+	}))
+	server.Listener = lis
+	server.Start()
+	defer server.Close()
+
+	// The proxy must not be used for the socket.
+	client, err := NewClient(ClientOptions{Proxy: "http://proxy.invalid:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+	resp, err := Send(context.Background(), data, "unix://"+path, SendOptions{Client: client})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp.RequestIntervalInMinutes != 60 {
+		t.Errorf("requestIntervalInMinutes = %d, want response from the socket", resp.RequestIntervalInMinutes)
+	}
+	if gotPath != "/" || gotHost != unixSocketHost {
+		t.Errorf("request path = %q, host = %q; want / and %s", gotPath, gotHost, unixSocketHost)
+	}
+}
@@ -0,0 +1,301 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// listPageSize bounds each List response so large clusters do not produce
+// oversized API responses. Node objects are large, so they use smaller pages.
+const (
+	listPageSize        = 500
+	defaultNodePageSize = 100
+)
+
+// paginate calls list with successive continue tokens until the server
+// reports no more pages. list returns the continue token of its response.
+func paginate(list func(opts metav1.ListOptions) (string, error)) error {
+	return paginateN(listPageSize, list)
+}
+
+// paginateN is paginate with an explicit page size.
+func paginateN(limit int64, list func(opts metav1.ListOptions) (string, error)) error {
+	opts := metav1.ListOptions{Limit: limit}
+	for {
+		next, err := list(opts)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		opts.Continue = next
+	}
+}
+
+// podCounts is what is reported about pods across all namespaces.
+type podCounts struct {
+	total   int
+	running int
+	// perNamespace counts pods by namespace name. The names are never sent.
+	perNamespace map[string]int
+}
+
+// countPods counts the pods across all namespaces, in total, in the Running
+// phase, and per namespace. Only pod metadata is listed: every pod for the
+// total and per-namespace counts, then the Running pods, selected by the API
+// server, for the running count.
+func countPods(ctx context.Context, client metadata.Interface) (*podCounts, error) {
+	pods := client.Resource(corev1.SchemeGroupVersion.WithResource("pods")).Namespace(metav1.NamespaceAll)
+	counts := &podCounts{perNamespace: make(map[string]int)}
+	err := paginate(func(opts metav1.ListOptions) (string, error) {
+		list, err := pods.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, pod := range list.Items {
+			counts.total++
+			counts.perNamespace[pod.Namespace]++
+		}
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	running := fields.OneTermEqualSelector("status.phase", string(corev1.PodRunning)).String()
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		opts.FieldSelector = running
+		list, err := pods.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		counts.running += len(list.Items)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// nameHashLength is the number of hex digits of SHA-256 kept in hashed
+// namespace and node names: enough to tell them apart, and short in the
+// payload.
+const nameHashLength = 12
+
+// hashName returns the truncated hex SHA-256 of name.
+func hashName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:nameHashLength]
+}
+
+// namespacePods is one entry of topNamespaces.
+type namespacePods struct {
+	Namespace string `json:"namespace"`
+	Pods      int    `json:"pods"`
+}
+
+// topNamespaces returns the n namespaces with the most pods, largest first,
+// identified by the truncated hex SHA-256 of their names. Ties are ordered
+// by hash so the result is stable.
+func topNamespaces(perNamespace map[string]int, n int) []namespacePods {
+	top := make([]namespacePods, 0, len(perNamespace))
+	for name, pods := range perNamespace {
+		top = append(top, namespacePods{Namespace: hashName(name), Pods: pods})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Pods != top[j].Pods {
+			return top[i].Pods > top[j].Pods
+		}
+		return top[i].Namespace < top[j].Namespace
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// countNetworkPolicies returns the number of NetworkPolicies across all
+// namespaces and how many namespaces have at least one.
+func countNetworkPolicies(ctx context.Context, clientset kubernetes.Interface) (total, namespaces int, err error) {
+	seen := make(map[string]bool)
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		policies, err := clientset.NetworkingV1().NetworkPolicies(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, policy := range policies.Items {
+			total++
+			seen[policy.Namespace] = true
+		}
+		return policies.Continue, nil
+	})
+	return total, len(seen), err
+}
+
+// countExposedServices returns the number of LoadBalancer and NodePort
+// Services across all namespaces.
+func countExposedServices(ctx context.Context, clientset kubernetes.Interface) (loadBalancers, nodePorts int, err error) {
+	err = paginate(func(opts metav1.ListOptions) (string, error) {
+		services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, svc := range services.Items {
+			switch svc.Spec.Type {
+			case corev1.ServiceTypeLoadBalancer:
+				loadBalancers++
+			case corev1.ServiceTypeNodePort:
+				nodePorts++
+			}
+		}
+		return services.Continue, nil
+	})
+	return loadBalancers, nodePorts, err
+}
+
+// hashClusterUUID returns the hex SHA-256 of salt followed by uid. The same
+// inputs always give the same value, so reports from one cluster still match.
+func hashClusterUUID(uid, salt string) string {
+	sum := sha256.Sum256([]byte(salt + uid))
+	return hex.EncodeToString(sum[:])
+}
+
+// podSecurityEnforceLabel is the Pod Security admission enforcement label.
+const podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+// namespaceSummary is what is reported about namespaces without their names.
+type namespaceSummary struct {
+	count int
+	// digest is the hex SHA-256 of the sorted, newline-joined names, so that
+	// changes can be detected without sending the names themselves.
+	digest string
+	// podSecurity counts namespaces per enforced Pod Security level, with
+	// "none" for namespaces without the label.
+	podSecurity map[string]int
+}
+
+// summarizeNamespaces lists all namespaces once and summarizes them.
+func summarizeNamespaces(ctx context.Context, clientset kubernetes.Interface) (*namespaceSummary, error) {
+	var names []string
+	podSecurity := make(map[string]int)
+	err := paginate(func(opts metav1.ListOptions) (string, error) {
+		namespaces, err := clientset.CoreV1().Namespaces().List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, ns := range namespaces.Items {
+			names = append(names, ns.Name)
+			level := ns.Labels[podSecurityEnforceLabel]
+			if level == "" {
+				level = "none"
+			}
+			podSecurity[level]++
+		}
+		return namespaces.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, "\n")))
+	return &namespaceSummary{
+		count:       len(names),
+		digest:      hex.EncodeToString(sum[:]),
+		podSecurity: podSecurity,
+	}, nil
+}
+
+// apiServerService is the Service in the default namespace whose endpoints
+// the API servers maintain, one address per server.
+const apiServerService = "kubernetes"
+
+// endpointSliceVersion is the first Kubernetes release serving the
+// discovery.k8s.io/v1 EndpointSlice API.
+var endpointSliceVersion = utilversion.MajorMinor(1, 21)
+
+// servesEndpointSlices reports whether the server version has the
+// discovery.k8s.io/v1 EndpointSlice API. Unparseable versions are assumed to
+// be current.
+func servesEndpointSlices(info *version.Info) bool {
+	v, err := utilversion.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return true
+	}
+	return v.AtLeast(endpointSliceVersion)
+}
+
+// countAPIServerEndpoints returns the number of distinct ready API server
+// addresses behind the kubernetes Service. It reads the Service's
+// EndpointSlices, or its deprecated Endpoints on servers older than
+// Kubernetes 1.21, so useSlices should come from servesEndpointSlices.
+func countAPIServerEndpoints(ctx context.Context, clientset kubernetes.Interface, useSlices bool) (int, error) {
+	addresses := make(map[string]bool)
+	if useSlices {
+		slices, err := clientset.DiscoveryV1().EndpointSlices(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + apiServerService,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, slice := range slices.Items {
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+					continue
+				}
+				for _, address := range endpoint.Addresses {
+					addresses[address] = true
+				}
+			}
+		}
+		return len(addresses), nil
+	}
+
+	endpoints, err := clientset.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, apiServerService, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			addresses[address.IP] = true
+		}
+	}
+	return len(addresses), nil
+}
+
+// defaultServiceCIDR is the ServiceCIDR object the API server creates for its
+// --service-cluster-ip-range.
+const defaultServiceCIDR = "kubernetes"
+
+// detectServiceCIDR returns the cluster's service CIDRs, comma-separated for
+// dual-stack, from the default ServiceCIDR object. Clusters without the
+// ServiceCIDR API (before Kubernetes 1.33) report "unknown": the kubernetes
+// Service shows an address in the range but not its size.
+func detectServiceCIDR(ctx context.Context, clientset kubernetes.Interface) string {
+	serviceCIDR, err := clientset.NetworkingV1().ServiceCIDRs().Get(ctx, defaultServiceCIDR, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			logrus.WithError(err).Warn("failed to get default ServiceCIDR")
+		}
+		return "unknown"
+	}
+	if len(serviceCIDR.Spec.CIDRs) == 0 {
+		return "unknown"
+	}
+	return strings.Join(serviceCIDR.Spec.CIDRs, ",")
+}
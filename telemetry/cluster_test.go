@@ -0,0 +1,465 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPaginate(t *testing.T) {
+	pages := []string{"page-2", "page-3", ""}
+	var seen []string
+
+	err := paginate(func(opts metav1.ListOptions) (string, error) {
+		if opts.Limit != listPageSize {
+			t.Errorf("Limit = %d, want %d", opts.Limit, listPageSize)
+		}
+		seen = append(seen, opts.Continue)
+		return pages[len(seen)-1], nil
+	})
+	if err != nil {
+		t.Fatalf("paginate() error = %v", err)
+	}
+
+	want := []string{"", "page-2", "page-3"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("continue tokens = %v, want %v", seen, want)
+	}
+}
+
+func TestCollect_PodCounts(t *testing.T) {
+	pods := []*metav1.PartialObjectMetadata{
+		objectMetadata("Pod", "kube-system", "a"),
+		objectMetadata("Pod", "default", "b"),
+		objectMetadata("Pod", "default", "c"),
+		objectMetadata("Pod", "default", "d"),
+	}
+	// Pods a and b are Running. The fake client ignores field selectors, so
+	// the reactor below answers the phase selector with them.
+	running := &metav1.List{Items: []runtime.RawExtension{{Object: pods[0]}, {Object: pods[1]}}}
+
+	top := []namespacePods{{Namespace: "37a8eec1ce19", Pods: 3}, {Namespace: "88007f70666d", Pods: 1}}
+
+	tests := []struct {
+		mode        string
+		denied      bool
+		wantTotal   interface{}
+		wantRunning interface{}
+		wantTop     interface{}
+	}{
+		{"recommended", false, 4, 2, top},
+		{"minimal", false, -1, -1, []namespacePods{}},
+		{"recommended", true, nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+			objects := make([]runtime.Object, 0, len(pods))
+			for _, pod := range pods {
+				objects = append(objects, pod)
+			}
+			client := metadataClient(objects...)
+			client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.(k8stesting.ListAction).GetListRestrictions().Fields.String() != "status.phase=Running" {
+					return false, nil, nil
+				}
+				return true, running, nil
+			})
+			if tt.denied {
+				forbidden(client, "list", "pods")
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode, Metadata: client, TopNamespaces: 5})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["podCount"] != tt.wantTotal {
+				t.Errorf("podCount = %v, want %v", data.ExtraFieldInfo["podCount"], tt.wantTotal)
+			}
+			if data.ExtraFieldInfo["runningPodCount"] != tt.wantRunning {
+				t.Errorf("runningPodCount = %v, want %v", data.ExtraFieldInfo["runningPodCount"], tt.wantRunning)
+			}
+			if got := data.ExtraFieldInfo["topNamespaces"]; !reflect.DeepEqual(got, tt.wantTop) {
+				t.Errorf("topNamespaces = %v, want %v", got, tt.wantTop)
+			}
+		})
+	}
+}
+
+func TestTopNamespaces(t *testing.T) {
+	perNamespace := map[string]int{"default": 3, "kube-system": 8, "tenant-a": 3, "tenant-b": 20}
+
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{2, []int{20, 8}},
+		{5, []int{20, 8, 3, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			top := topNamespaces(perNamespace, tt.n)
+			var pods []int
+			for _, entry := range top {
+				pods = append(pods, entry.Pods)
+				if len(entry.Namespace) != nameHashLength || strings.Contains(entry.Namespace, "tenant") {
+					t.Errorf("namespace = %q, want a %d-digit hash", entry.Namespace, nameHashLength)
+				}
+			}
+			if !reflect.DeepEqual(pods, tt.want) {
+				t.Errorf("pod counts = %v, want %v", pods, tt.want)
+			}
+			if !reflect.DeepEqual(top, topNamespaces(perNamespace, tt.n)) {
+				t.Error("topNamespaces() is not deterministic")
+			}
+		})
+	}
+}
+
+func TestSummarizeNamespaces_Digest(t *testing.T) {
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("default\nkube-system")))
+
+	// Creation order must not affect the digest.
+	for _, order := range [][]string{{"default", "kube-system"}, {"kube-system", "default"}} {
+		t.Run(strings.Join(order, ","), func(t *testing.T) {
+			clientset := fake.NewClientset(namespace(order[0]), namespace(order[1]))
+			summary, err := summarizeNamespaces(context.Background(), clientset)
+			if err != nil {
+				t.Fatalf("summarizeNamespaces() error = %v", err)
+			}
+			if summary.count != 2 {
+				t.Errorf("count = %d, want 2", summary.count)
+			}
+			if summary.digest != want {
+				t.Errorf("digest = %s, want %s", summary.digest, want)
+			}
+		})
+	}
+}
+
+func TestCollect_Namespaces(t *testing.T) {
+	tests := []struct {
+		mode       string
+		denied     bool
+		wantCount  interface{}
+		wantDigest bool
+	}{
+		{"recommended", false, 1, true},
+		{"minimal", false, -1, false},
+		{"recommended", true, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			if tt.denied {
+				forbidden(clientset, "list", "namespaces")
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["namespaceCount"] != tt.wantCount {
+				t.Errorf("namespaceCount = %v, want %v", data.ExtraFieldInfo["namespaceCount"], tt.wantCount)
+			}
+			digest, _ := data.ExtraFieldInfo["namespaceDigest"].(string)
+			if (digest != "") != tt.wantDigest {
+				t.Errorf("namespaceDigest = %q, want present = %v", digest, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestCollect_HashClusterUUID(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CollectOptions
+		want string
+	}{
+		{"default", CollectOptions{}, "uuid"},
+		{"hashed", CollectOptions{HashClusterUUID: true}, fmt.Sprintf("%x", sha256.Sum256([]byte("uuid")))},
+		{"salted", CollectOptions{HashClusterUUID: true, ClusterUUIDSalt: "salt"}, fmt.Sprintf("%x", sha256.Sum256([]byte("saltuuid")))},
+		{"salt ignored without hashing", CollectOptions{ClusterUUIDSalt: "salt"}, "uuid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			tt.opts.Mode = "recommended"
+
+			data, err := Collect(context.Background(), clientset, tt.opts)
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if got := data.ExtraTagInfo["clusteruuid"]; got != tt.want {
+				t.Errorf("clusteruuid = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeNamespaces_PodSecurity(t *testing.T) {
+	namespace := func(name, level string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if level != "" {
+			ns.Labels = map[string]string{podSecurityEnforceLabel: level}
+		}
+		return ns
+	}
+	clientset := fake.NewClientset(
+		namespace("kube-system", "privileged"),
+		namespace("default", ""),
+		namespace("team-a", "restricted"),
+		namespace("team-b", "restricted"),
+		namespace("team-c", "baseline"),
+	)
+
+	summary, err := summarizeNamespaces(context.Background(), clientset)
+	if err != nil {
+		t.Fatalf("summarizeNamespaces() error = %v", err)
+	}
+	want := map[string]int{"privileged": 1, "baseline": 1, "restricted": 2, "none": 1}
+	if !reflect.DeepEqual(summary.podSecurity, want) {
+		t.Errorf("podSecurity = %v, want %v", summary.podSecurity, want)
+	}
+}
+
+func TestCollect_NetworkPolicies(t *testing.T) {
+	policy := func(namespace, name string) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		policy("kube-system", "default-network-policy"),
+		policy("team-a", "deny-all"),
+		policy("team-a", "allow-dns"),
+	}
+
+	tests := []struct {
+		mode           string
+		denied         bool
+		wantPolicies   interface{}
+		wantNamespaces interface{}
+	}{
+		{"recommended", false, 3, 2},
+		{"minimal", false, -1, -1},
+		{"recommended", true, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(objects...)
+			if tt.denied {
+				forbidden(clientset, "list", "networkpolicies")
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["networkPolicyCount"] != tt.wantPolicies {
+				t.Errorf("networkPolicyCount = %v, want %v", data.ExtraFieldInfo["networkPolicyCount"], tt.wantPolicies)
+			}
+			if data.ExtraFieldInfo["namespacesWithNetworkPolicy"] != tt.wantNamespaces {
+				t.Errorf("namespacesWithNetworkPolicy = %v, want %v", data.ExtraFieldInfo["namespacesWithNetworkPolicy"], tt.wantNamespaces)
+			}
+		})
+	}
+}
+
+func TestCollect_ExposedServices(t *testing.T) {
+	service := func(namespace, name string, serviceType corev1.ServiceType) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Spec: corev1.ServiceSpec{Type: serviceType}}
+	}
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		service("default", "kubernetes", corev1.ServiceTypeClusterIP),
+		service("ingress", "web", corev1.ServiceTypeLoadBalancer),
+		service("ingress", "api", corev1.ServiceTypeLoadBalancer),
+		service("apps", "debug", corev1.ServiceTypeNodePort),
+		service("apps", "db", ""),
+	}
+
+	tests := []struct {
+		mode              string
+		denied            bool
+		wantLoadBalancers interface{}
+		wantNodePorts     interface{}
+	}{
+		{"recommended", false, 2, 1},
+		{"minimal", false, -1, -1},
+		{"recommended", true, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/denied=%v", tt.mode, tt.denied), func(t *testing.T) {
+			clientset := fake.NewClientset(objects...)
+			if tt.denied {
+				forbidden(clientset, "list", "services")
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: tt.mode})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["loadBalancerServices"] != tt.wantLoadBalancers {
+				t.Errorf("loadBalancerServices = %v, want %v", data.ExtraFieldInfo["loadBalancerServices"], tt.wantLoadBalancers)
+			}
+			if data.ExtraFieldInfo["nodePortServices"] != tt.wantNodePorts {
+				t.Errorf("nodePortServices = %v, want %v", data.ExtraFieldInfo["nodePortServices"], tt.wantNodePorts)
+			}
+		})
+	}
+}
+
+func TestDetectServiceCIDR(t *testing.T) {
+	serviceCIDR := func(name string, cidrs ...string) *networkingv1.ServiceCIDR {
+		return &networkingv1.ServiceCIDR{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: networkingv1.ServiceCIDRSpec{CIDRs: cidrs}}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		denied  bool
+		want    string
+	}{
+		{"single stack", []runtime.Object{serviceCIDR("kubernetes", "10.43.0.0/16")}, false, "10.43.0.0/16"},
+		{"dual-stack", []runtime.Object{serviceCIDR("kubernetes", "10.43.0.0/16", "2001:cafe:43::/112")}, false, "10.43.0.0/16,2001:cafe:43::/112"},
+		{"only additional ranges", []runtime.Object{serviceCIDR("extra", "10.44.0.0/16")}, false, "unknown"},
+		{"no ServiceCIDR API", nil, false, "unknown"},
+		{"forbidden", []runtime.Object{serviceCIDR("kubernetes", "10.43.0.0/16")}, true, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.denied {
+				forbidden(clientset, "get", "servicecidrs")
+			}
+			if got := detectServiceCIDR(context.Background(), clientset); got != tt.want {
+				t.Errorf("detectServiceCIDR() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollect_ClusterAge(t *testing.T) {
+	created := time.Now().Add(-30 * 24 * time.Hour)
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid", CreationTimestamp: metav1.NewTime(created)}},
+	)
+
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	age, ok := data.ExtraFieldInfo["clusterAge"].(int64)
+	if want := int64(30 * 24 * 3600); !ok || age < want || age > want+60 {
+		t.Errorf("clusterAge = %v, want about %d", data.ExtraFieldInfo["clusterAge"], want)
+	}
+}
+
+func TestCountAPIServerEndpoints(t *testing.T) {
+	slice := func(name, service string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: metav1.NamespaceDefault,
+				Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+			},
+			Endpoints: endpoints,
+		}
+	}
+	endpoint := func(address string, ready bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{Addresses: []string{address}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}
+	}
+	//nolint:staticcheck // SA1019: Endpoints are read on servers before 1.21.
+	legacy := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: metav1.NamespaceDefault},
+		Subsets:    []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}}},
+	}
+
+	tests := []struct {
+		name      string
+		objects   []runtime.Object
+		useSlices bool
+		forbidden bool
+		want      int
+		wantErr   bool
+	}{
+		{
+			name: "endpoint slices",
+			objects: []runtime.Object{
+				slice("kubernetes", "kubernetes", endpoint("10.0.0.1", true), endpoint("10.0.0.2", true), endpoint("10.0.0.4", false)),
+				slice("kubernetes-2", "kubernetes", endpoint("10.0.0.2", true), endpoint("10.0.0.3", true)),
+				slice("other", "other", endpoint("10.0.0.9", true)),
+				legacy,
+			},
+			useSlices: true,
+			want:      3,
+		},
+		{name: "no slices", objects: []runtime.Object{legacy}, useSlices: true, want: 0},
+		{name: "endpoints", objects: []runtime.Object{legacy, slice("kubernetes", "kubernetes", endpoint("10.0.0.1", true))}, want: 2},
+		{name: "no endpoints", wantErr: true},
+		{name: "forbidden", objects: []runtime.Object{legacy}, useSlices: true, forbidden: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden {
+				forbidden(clientset, "list", "endpointslices")
+			}
+			got, err := countAPIServerEndpoints(context.Background(), clientset, tt.useSlices)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countAPIServerEndpoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("countAPIServerEndpoints() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServesEndpointSlices(t *testing.T) {
+	tests := []struct {
+		gitVersion string
+		want       bool
+	}{
+		{"v1.20.15+rke2r2", false},
+		{"v1.21.0+rke2r1", true},
+		{"v1.33.1+rke2r1", true},
+		{"dev", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gitVersion, func(t *testing.T) {
+			if got := servesEndpointSlices(&version.Info{GitVersion: tt.gitVersion}); got != tt.want {
+				t.Errorf("servesEndpointSlices(%q) = %v, want %v", tt.gitVersion, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Detector reports one or more ExtraFieldInfo entries. Collect runs each
+// detector as its own step; an error is logged and the entries left out, so
+// a failing detector never fails the collection.
+type Detector interface {
+	// Name identifies the detector in logs and in DisableDetectors.
+	Name() string
+	// Detect returns the entries to report, by ExtraFieldInfo key.
+	Detect(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error)
+}
+
+// detector is a Detector reporting detect's result under key.
+type detector struct {
+	name   string
+	key    string
+	detect func(ctx context.Context, clientset kubernetes.Interface) (interface{}, error)
+}
+
+func (d detector) Name() string { return d.name }
+
+func (d detector) Detect(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	value, err := d.detect(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{d.key: value}, nil
+}
+
+// fieldsDetector is a Detector whose detect function reports several
+// top-level entries itself.
+type fieldsDetector struct {
+	name   string
+	detect func(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error)
+}
+
+func (d fieldsDetector) Name() string { return d.name }
+
+func (d fieldsDetector) Detect(ctx context.Context, clientset kubernetes.Interface) (map[string]interface{}, error) {
+	return d.detect(ctx, clientset)
+}
+
+// infallible adapts a detection function that degrades to a placeholder
+// value itself instead of returning an error.
+func infallible[T any](fn func(ctx context.Context, clientset kubernetes.Interface) T) func(context.Context, kubernetes.Interface) (interface{}, error) {
+	return func(ctx context.Context, clientset kubernetes.Interface) (interface{}, error) {
+		return fn(ctx, clientset), nil
+	}
+}
+
+// fallible adapts a detection function that returns an error on failure.
+func fallible[T any](fn func(ctx context.Context, clientset kubernetes.Interface) (T, error)) func(context.Context, kubernetes.Interface) (interface{}, error) {
+	return func(ctx context.Context, clientset kubernetes.Interface) (interface{}, error) {
+		return fn(ctx, clientset)
+	}
+}
+
+// DefaultDetectors returns the add-on detectors Collect runs when
+// CollectOptions.Detectors is nil. Their values are the same in both modes.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		detector{"service-mesh", "service-mesh", infallible(detectServiceMesh)},
+		detector{"cert-manager", "certManager", fallible(detectCertManager)},
+		detector{"metrics-server", "metricsServer", fallible(detectMetricsServer)},
+		fieldsDetector{"kubernetes-dashboard", detectDashboard},
+		fieldsDetector{"policy-engines", detectPolicyEngines},
+		fieldsDetector{"backup-tools", detectBackupTools},
+		detector{"csi-drivers", "csiDrivers", infallible(detectCSIDrivers)},
+		detector{"default-storageclass", "defaultStorageClass", fallible(detectDefaultStorageClass)},
+		detector{"audit-logging", "auditLogging", infallible(detectAuditLogging)},
+		detector{"ip-stack", "ip-stack", infallible(detectIPStack)},
+		detector{"loadbalancer-provider", "loadBalancerProvider", infallible(detectLoadBalancerProvider)},
+		detector{"local-registry-hosting", "localRegistryHosting", fallible(detectLocalRegistryHosting)},
+	}
+}
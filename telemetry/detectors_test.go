@@ -0,0 +1,145 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDefaultDetectors_UniqueNames(t *testing.T) {
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, d := range DefaultDetectors() {
+		if names[d.Name()] {
+			t.Errorf("duplicate detector %q", d.Name())
+		}
+		names[d.Name()] = true
+		entries, _ := d.Detect(context.Background(), fake.NewClientset())
+		for key := range entries {
+			if keys[key] {
+				t.Errorf("detector %q reports duplicate key %q", d.Name(), key)
+			}
+			keys[key] = true
+		}
+	}
+}
+
+func TestCollect_Detectors(t *testing.T) {
+	static := func(name, key string, value interface{}, err error) Detector {
+		return detector{name, key, func(context.Context, kubernetes.Interface) (interface{}, error) {
+			return value, err
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		opts     CollectOptions
+		wantKeys map[string]bool
+	}{
+		{
+			name:     "defaults",
+			opts:     CollectOptions{},
+			wantKeys: map[string]bool{"ip-stack": true, "service-mesh": true, "csiDrivers": true},
+		},
+		{
+			name:     "disabled default",
+			opts:     CollectOptions{DisableDetectors: []string{"ip-stack"}},
+			wantKeys: map[string]bool{"ip-stack": false, "service-mesh": true},
+		},
+		{
+			name: "custom detectors",
+			opts: CollectOptions{Detectors: []Detector{
+				static("ok", "custom", "value", nil),
+				static("broken", "broken", "ignored", errors.New("boom")),
+				fieldsDetector{"several", func(context.Context, kubernetes.Interface) (map[string]interface{}, error) {
+					return map[string]interface{}{"first": 1, "second": 2}, nil
+				}},
+			}},
+			wantKeys: map[string]bool{"custom": true, "broken": false, "ip-stack": false, "first": true, "second": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			tt.opts.Mode = "recommended"
+			data, err := Collect(context.Background(), clientset, tt.opts)
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			for key, want := range tt.wantKeys {
+				if _, ok := data.ExtraFieldInfo[key]; ok != want {
+					t.Errorf("%s reported = %v, want %v", key, ok, want)
+				}
+			}
+		})
+	}
+}
+
+// TestCollect_DetectorKeys pins the top-level keys each default detector
+// adds to the payload, which receivers depend on.
+func TestCollect_DetectorKeys(t *testing.T) {
+	want := map[string][]string{
+		"service-mesh":           {"service-mesh"},
+		"cert-manager":           {"certManager"},
+		"metrics-server":         {"metricsServer"},
+		"kubernetes-dashboard":   {"dashboardInstalled", "dashboardVersion"},
+		"policy-engines":         {"policyEngine", "policyEngineVersions"},
+		"backup-tools":           {"backupTool", "backupTools", "veleroVersion"},
+		"csi-drivers":            {"csiDrivers"},
+		"default-storageclass":   {"defaultStorageClass"},
+		"audit-logging":          {"auditLogging"},
+		"ip-stack":               {"ip-stack"},
+		"loadbalancer-provider":  {"loadBalancerProvider"},
+		"local-registry-hosting": {"localRegistryHosting"},
+	}
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		deployment("kubernetes-dashboard", "kubernetes-dashboard", "kubernetesui/dashboard:v2.7.0"),
+		deployment("kyverno", "kyverno", "ghcr.io/kyverno/kyverno:v1.13.2"),
+		deployment("velero", "velero", "velero/velero:v1.15.2"),
+	}
+	collectKeys := func(t *testing.T, detectors []Detector) map[string]bool {
+		t.Helper()
+		data, err := Collect(context.Background(), fake.NewClientset(objects...), CollectOptions{Mode: "recommended", Detectors: detectors})
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		keys := make(map[string]bool, len(data.ExtraFieldInfo))
+		for key := range data.ExtraFieldInfo {
+			keys[key] = true
+		}
+		return keys
+	}
+	base := collectKeys(t, []Detector{})
+
+	for _, d := range DefaultDetectors() {
+		t.Run(d.Name(), func(t *testing.T) {
+			wantKeys, ok := want[d.Name()]
+			if !ok {
+				t.Fatalf("no expected keys for detector %q", d.Name())
+			}
+			var got []string
+			for key := range collectKeys(t, []Detector{d}) {
+				if !base[key] {
+					got = append(got, key)
+				}
+			}
+			sort.Strings(got)
+			sort.Strings(wantKeys)
+			if !reflect.DeepEqual(got, wantKeys) {
+				t.Errorf("keys = %v, want %v", got, wantKeys)
+			}
+		})
+	}
+}
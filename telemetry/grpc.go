@@ -0,0 +1,232 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rancher/rke2-security-responder/telemetry/telemetrypb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// newReport builds the Report message for data. ExtraFieldInfo values are
+// of mixed types, so the map is carried as a JSON object.
+func newReport(data *Data) (*telemetrypb.Report, error) {
+	fields, err := json.Marshal(data.ExtraFieldInfo)
+	if err != nil {
+		return nil, err
+	}
+	// Tags are sorted so that the encoding, and with it the HMAC signature,
+	// is reproducible.
+	tags := make([]*telemetrypb.Tag, 0, len(data.ExtraTagInfo))
+	for _, key := range sortedKeys(data.ExtraTagInfo) {
+		tags = append(tags, &telemetrypb.Tag{Key: key, Value: data.ExtraTagInfo[key]})
+	}
+	return &telemetrypb.Report{
+		AppVersion:     data.AppVersion,
+		ExtraTagInfo:   tags,
+		ExtraFieldInfo: fields,
+		SchemaVersion:  data.SchemaVersion,
+	}, nil
+}
+
+// marshalReport encodes data as a Report message.
+func marshalReport(data *Data) ([]byte, error) {
+	report, err := newReport(data)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(report)
+}
+
+// grpcConnKey identifies a client connection by its target and the
+// settings it was created with.
+type grpcConnKey struct {
+	target    string
+	secure    bool
+	userAgent string
+	client    *http.Client
+}
+
+// grpcConns holds one client connection per key for the life of the
+// process. A ClientConn reconnects by itself, so it is reused across sends
+// rather than dialed for each one.
+var grpcConns = struct {
+	sync.Mutex
+	conns map[grpcConnKey]*grpc.ClientConn
+}{conns: make(map[grpcConnKey]*grpc.ClientConn)}
+
+// grpcConn returns the connection for key, creating it on first use. The
+// TLS settings come from the client built by NewClient.
+func grpcConn(key grpcConnKey) (*grpc.ClientConn, error) {
+	grpcConns.Lock()
+	defer grpcConns.Unlock()
+	if conn, ok := grpcConns.conns[key]; ok {
+		return conn, nil
+	}
+	creds := insecure.NewCredentials()
+	if key.secure {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if key.client != nil {
+			if transport, ok := key.client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+				tlsConfig = transport.TLSClientConfig.Clone()
+			}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(key.target, grpc.WithTransportCredentials(creds), grpc.WithUserAgent(key.userAgent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	grpcConns.conns[key] = conn
+	return conn, nil
+}
+
+// grpcTarget returns the host:port to dial for endpoint, defaulting to port
+// 443, and whether the connection uses TLS. Only the endpoint's scheme and
+// host are used. Unix socket endpoints are dialed as is, without TLS.
+func grpcTarget(endpoint string) (string, bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme == unixScheme {
+		return unixScheme + "://" + u.Path, false, nil
+	}
+	if u.Host == "" {
+		return "", false, fmt.Errorf("invalid endpoint %q: missing host", endpoint)
+	}
+	secure := u.Scheme != "http"
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if !secure {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), secure, nil
+}
+
+// retryableCode reports whether a failed RPC may succeed when retried.
+func retryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// sendGRPC streams the Report message for data to endpoint's Ingest
+// service, with the same retries, credentials, and TLS settings as the HTTP
+// formats. message is its encoding, which the signature covers. The proxy
+// from ClientOptions is not used; gRPC honors HTTPS_PROXY and NO_PROXY
+// itself.
+func sendGRPC(ctx context.Context, message []byte, endpoint string, data *Data, opts SendOptions) error {
+	target, secure, err := grpcTarget(endpoint)
+	if err != nil {
+		return err
+	}
+	report, err := newReport(data)
+	if err != nil {
+		return fmt.Errorf("failed to build report: %w", err)
+	}
+	timeout := defaultTimeout
+	if opts.Client != nil && opts.Client.Timeout > 0 {
+		timeout = opts.Client.Timeout
+	}
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	conn, err := grpcConn(grpcConnKey{target: target, secure: secure, userAgent: userAgent, client: opts.Client})
+	if err != nil {
+		return err
+	}
+	client := telemetrypb.NewIngestClient(conn)
+
+	md := metadata.MD{}
+	if reportID := data.ExtraTagInfo[reportIDKey]; reportID != "" {
+		md.Set("x-idempotency-key", reportID)
+	}
+	if data.SchemaVersion != "" {
+		md.Set("x-schema-version", data.SchemaVersion)
+	}
+	if opts.AuthToken != "" {
+		md.Set("authorization", "Bearer "+opts.AuthToken)
+	}
+	// The signature covers the encoded Report; gRPC compression is applied
+	// by the transport and does not change it.
+	if opts.HMACKey != "" {
+		md.Set("x-signature", signBody(message, opts.HMACKey))
+	}
+	var callOpts []grpc.CallOption
+	if opts.Compress {
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+
+	var lastErr error
+	maxAttempts := opts.MaxRetries + 1
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := backoffDelay(attempt-1, opts.RetryDelay, opts.MaxRetryDelay)
+			logrus.WithFields(logrus.Fields{"attempt": attempt, "max": maxAttempts, "delay": delay}).Info("retrying")
+			sendRetriesTotal.Inc()
+			if err := sleepContext(ctx, delay); err != nil {
+				return fmt.Errorf("retry aborted: %w", err)
+			}
+		}
+
+		lastErr = streamReport(metadata.NewOutgoingContext(ctx, md), client, report, timeout, callOpts)
+		if lastErr == nil {
+			logrus.WithField("attempt", attempt).Info("data sent")
+			return nil
+		}
+		st := status.Convert(lastErr)
+		lastErr = fmt.Errorf("rpc failed with code %s", st.Code())
+		// Receivers usually explain a rejection in the status message.
+		log := logrus.WithFields(logrus.Fields{
+			"attempt":       attempt,
+			"statusMessage": responseSnippet([]byte(st.Message()), opts.AuthToken, opts.HMACKey),
+		})
+		if !retryableCode(st.Code()) {
+			log.WithError(lastErr).Warn("attempt failed, not retrying")
+			return lastErr
+		}
+		log.WithError(lastErr).Warn("attempt failed")
+	}
+	return lastErr
+}
+
+// streamReport sends report as the only Report on one Ingest.Report stream
+// and waits for the acknowledgement, within timeout.
+func streamReport(ctx context.Context, client telemetrypb.IngestClient, report *telemetrypb.Report, timeout time.Duration, callOpts []grpc.CallOption) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stream, err := client.Report(ctx, callOpts...)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(report); err != nil {
+		// The cause of a failed send is reported by CloseAndRecv.
+		if _, recvErr := stream.CloseAndRecv(); recvErr != nil {
+			return recvErr
+		}
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
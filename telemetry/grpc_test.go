@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rancher/rke2-security-responder/telemetry/telemetrypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// reportData converts a received Report back into Data.
+func reportData(t *testing.T, report *telemetrypb.Report) *Data {
+	t.Helper()
+	data := &Data{
+		AppVersion:    report.GetAppVersion(),
+		SchemaVersion: report.GetSchemaVersion(),
+		ExtraTagInfo:  map[string]string{},
+	}
+	for _, tag := range report.GetExtraTagInfo() {
+		data.ExtraTagInfo[tag.GetKey()] = tag.GetValue()
+	}
+	if err := json.Unmarshal(report.GetExtraFieldInfo(), &data.ExtraFieldInfo); err != nil {
+		t.Fatalf("extra_field_info is not JSON: %v", err)
+	}
+	return data
+}
+
+// ingestServer is an Ingest service that answers each Report stream with
+// the next of its codes (codes.OK once they run out), recording what it got.
+type ingestServer struct {
+	telemetrypb.UnimplementedIngestServer
+
+	mu       sync.Mutex
+	codes    []codes.Code
+	method   string
+	metadata metadata.MD
+	reports  []*telemetrypb.Report
+}
+
+func (s *ingestServer) Report(stream telemetrypb.Ingest_ReportServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.method, _ = grpc.MethodFromServerStream(stream)
+	s.metadata, _ = metadata.FromIncomingContext(stream.Context())
+	report, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	s.reports = append(s.reports, report)
+	if len(s.codes) > 0 {
+		code := s.codes[0]
+		s.codes = s.codes[1:]
+		if code != codes.OK {
+			return status.Error(code, "rejected token=secret-token")
+		}
+	}
+	return stream.SendAndClose(&telemetrypb.ReportAck{})
+}
+
+func startIngestServer(t *testing.T, s *ingestServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	telemetrypb.RegisterIngestServer(server, s)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return "http://" + lis.Addr().String()
+}
+
+func TestSend_GRPC(t *testing.T) {
+	data := &Data{
+		SchemaVersion:  SchemaVersion,
+		AppVersion:     "v1.32.2+rke2r1",
+		ExtraTagInfo:   map[string]string{"clusteruuid": "uuid", reportIDKey: "report-1"},
+		ExtraFieldInfo: map[string]interface{}{"nodeCount": float64(3), "cni-plugin": "canal"},
+	}
+
+	tests := []struct {
+		name         string
+		codes        []codes.Code
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"accepted", nil, false, 1},
+		{"retried while unavailable", []codes.Code{codes.Unavailable}, false, 2},
+		{"rejected", []codes.Code{codes.PermissionDenied}, true, 1},
+		{"retries exhausted", []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}, true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ingestServer{codes: tt.codes}
+			endpoint := startIngestServer(t, s)
+			opts := SendOptions{Format: FormatGRPC, MaxRetries: 2, AuthToken: "secret-token", HMACKey: "key", Compress: true}
+
+			_, err := Send(context.Background(), data, endpoint, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "secret-token") {
+				t.Errorf("Send() error = %v, leaks the status message", err)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if len(s.reports) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(s.reports), tt.wantAttempts)
+			}
+			if s.method != telemetrypb.Ingest_Report_FullMethodName {
+				t.Errorf("method = %q, want %q", s.method, telemetrypb.Ingest_Report_FullMethodName)
+			}
+			if got := s.metadata.Get("authorization"); !reflect.DeepEqual(got, []string{"Bearer secret-token"}) {
+				t.Errorf("authorization = %v, want bearer token", got)
+			}
+			if got := s.metadata.Get("x-idempotency-key"); !reflect.DeepEqual(got, []string{"report-1"}) {
+				t.Errorf("x-idempotency-key = %v, want report-1", got)
+			}
+			if got := s.metadata.Get("x-schema-version"); !reflect.DeepEqual(got, []string{SchemaVersion}) {
+				t.Errorf("x-schema-version = %v, want %s", got, SchemaVersion)
+			}
+			report := s.reports[len(s.reports)-1]
+			encoded, err := proto.Marshal(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := s.metadata.Get("x-signature"), []string{signBody(encoded, "key")}; !reflect.DeepEqual(got, want) {
+				t.Errorf("x-signature = %v, want %v", got, want)
+			}
+			if got := reportData(t, report); !reflect.DeepEqual(got, data) {
+				t.Errorf("report = %+v, want %+v", got, data)
+			}
+		})
+	}
+}
+
+func TestGRPCTarget(t *testing.T) {
+	tests := []struct {
+		endpoint   string
+		wantTarget string
+		wantSecure bool
+		wantErr    bool
+	}{
+		{"https://ingest.example.com", "ingest.example.com:443", true, false},
+		{"https://ingest.example.com:8443/ignored/path", "ingest.example.com:8443", true, false},
+		{"http://localhost:9000", "localhost:9000", false, false},
+		{"http://localhost", "localhost:80", false, false},
+		{"https://[::1]:8443", "[::1]:8443", true, false},
+		{"unix:///run/collector.sock", "unix:///run/collector.sock", false, false},
+		{"/no-host", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			target, secure, err := grpcTarget(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("grpcTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if target != tt.wantTarget || secure != tt.wantSecure {
+				t.Errorf("grpcTarget() = %q, %v; want %q, %v", target, secure, tt.wantTarget, tt.wantSecure)
+			}
+		})
+	}
+}
+
+func TestSend_GRPCReusesConnection(t *testing.T) {
+	s := &ingestServer{}
+	endpoint := startIngestServer(t, s)
+	target, _, err := grpcTarget(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := Send(context.Background(), data, endpoint, SendOptions{Format: FormatGRPC}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	grpcConns.Lock()
+	defer grpcConns.Unlock()
+	conns := 0
+	for key := range grpcConns.conns {
+		if key.target == target {
+			conns++
+		}
+	}
+	if conns != 1 {
+		t.Errorf("connections to %s = %d, want 1", target, conns)
+	}
+}
@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are registered on a dedicated registry so that only responder
+// metrics, plus the standard process and Go collectors, are exposed.
+var (
+	registry = prometheus.NewRegistry()
+
+	sendsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "security_responder_sends_total",
+		Help: "Payload deliveries by result (success or failure).",
+	}, []string{"result"})
+
+	sendDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "security_responder_send_duration_seconds",
+		Help:    "Time taken to deliver the payload, including retries.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+
+	sendRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "security_responder_send_retries_total",
+		Help: "Retries performed after a failed delivery attempt.",
+	})
+
+	endpointFailureStreak = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "security_responder_endpoint_failure_streak",
+		Help: "Consecutive failed deliveries per endpoint; 0 after a success.",
+	}, []string{"endpoint"})
+
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "security_responder_circuit_breaker_state",
+		Help: "Circuit breaker state per endpoint: 0 closed, 1 open, 2 half-open.",
+	}, []string{"endpoint"})
+
+	cycleDelay = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "security_responder_cycle_delay_seconds",
+		Help: "Delay until the next periodic cycle, including failure backoff.",
+	})
+
+	nodeCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "security_responder_nodes",
+		Help: "Nodes seen during the last collection, by role.",
+	}, []string{"role"})
+)
+
+func init() {
+	registry.MustRegister(
+		sendsTotal,
+		sendDuration,
+		sendRetriesTotal,
+		endpointFailureStreak,
+		circuitBreakerState,
+		cycleDelay,
+		nodeCount,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsHandler serves the responder metrics in the Prometheus format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// recordNodeCounts updates the node gauges from collected data. Counts
+// redacted in minimal mode (-1) are not exported.
+func recordNodeCounts(data *Data) {
+	for role, key := range map[string]string{
+		"server": "serverNodeCount",
+		"agent":  "agentNodeCount",
+		"gpu":    "gpuNodeCount",
+	} {
+		if n, ok := data.ExtraFieldInfo[key].(int); ok && n >= 0 {
+			nodeCount.WithLabelValues(role).Set(float64(n))
+		}
+	}
+}
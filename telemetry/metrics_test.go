@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_Send(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	failures := testutil.ToFloat64(sendsTotal.WithLabelValues("failure"))
+	retries := testutil.ToFloat64(sendRetriesTotal)
+
+	_, _ = Send(context.Background(), data, server.URL, SendOptions{MaxRetries: 2, RetryDelay: time.Millisecond})
+
+	if got := testutil.ToFloat64(sendsTotal.WithLabelValues("failure")) - failures; got != 1 {
+		t.Errorf("failure count increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(sendRetriesTotal) - retries; got != 2 {
+		t.Errorf("retry count increased by %v, want 2", got)
+	}
+}
+
+func TestMetrics_NodeCounts(t *testing.T) {
+	recordNodeCounts(&Data{ExtraFieldInfo: map[string]interface{}{
+		"serverNodeCount": 3,
+		"agentNodeCount":  5,
+		"gpuNodeCount":    -1,
+	}})
+
+	if got := testutil.ToFloat64(nodeCount.WithLabelValues("server")); got != 3 {
+		t.Errorf("server nodes = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(nodeCount.WithLabelValues("agent")); got != 5 {
+		t.Errorf("agent nodes = %v, want 5", got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "security_responder_send_retries_total") {
+		t.Error("metrics output missing security_responder_send_retries_total")
+	}
+}
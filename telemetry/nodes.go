@@ -0,0 +1,547 @@
+package telemetry
+
+import (
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var gpuResources = []corev1.ResourceName{"nvidia.com/gpu", "amd.com/gpu", "intel.com/gpu", "gpu.intel.com/i915", "gpu.intel.com/xe"}
+
+var gpuVendorMap = map[corev1.ResourceName]string{
+	"nvidia.com/gpu":     "nvidia",
+	"amd.com/gpu":        "amd",
+	"intel.com/gpu":      "intel",
+	"gpu.intel.com/i915": "intel",
+	"gpu.intel.com/xe":   "intel",
+}
+
+// controlPlaneTaints keep workloads off control-plane nodes. RKE2 documents
+// CriticalAddonsOnly for dedicated servers; the others are the upstream
+// control-plane taints.
+var controlPlaneTaints = map[string]bool{
+	"node-role.kubernetes.io/control-plane": true,
+	"node-role.kubernetes.io/master":        true,
+	"CriticalAddonsOnly":                    true,
+}
+
+// nodeSummary accumulates node statistics one node at a time, so that nodes
+// can be listed in pages without holding the whole list.
+type nodeSummary struct {
+	serverNodeCount, agentNodeCount, gpuNodeCount  int
+	dedicatedControlPlaneNodes                     int
+	serverCPU, agentCPU, serverMemory, agentMemory int64
+	operatingSystem, osImage, kernelVersion, arch  string
+	selinuxInfo, gpuVendor                         string
+
+	// Cluster-wide totals of node capacity and allocatable resources, in
+	// millicores and bytes.
+	capacityCPU, capacityMemory       int64
+	allocatableCPU, allocatableMemory int64
+
+	// etcd members are counted independently of the server/agent split;
+	// etcdOnlyNodeCount are those without the control-plane role.
+	etcdNodeCount, etcdOnlyNodeCount int
+
+	// osImages counts nodes per OS image; osKernels records the distinct
+	// kernel versions seen for each image.
+	osImages  map[string]int
+	osKernels map[string]map[string]bool
+	// selinuxNodes counts nodes per SELinux status.
+	selinuxNodes map[string]int
+	// containerRuntimes counts nodes per container runtime version, e.g.
+	// "containerd://1.7.27-k3s1".
+	containerRuntimes map[string]int
+	// kubeletVersions counts nodes per kubelet version.
+	kubeletVersions map[string]int
+	// architectures counts nodes per CPU architecture.
+	architectures map[string]int
+	// cloudProviders counts nodes per cloud provider, from their provider IDs.
+	cloudProviders map[string]int
+	// podCIDRs is the set of node pod CIDRs.
+	podCIDRs map[netip.Prefix]bool
+	// totalGPUs sums the GPUs advertised by all nodes; gpuResourceNames
+	// records the accelerator resources seen.
+	totalGPUs        int64
+	gpuResourceNames map[string]bool
+	// swapEnabledNodes have swap configured. Only kubelets recent enough to
+	// fill in NodeInfo.Swap report it; others count as swapUnknownNodes.
+	swapEnabledNodes, swapUnknownNodes int
+	// oldestNode and newestNode are the earliest and latest node creation
+	// times; ages are reported relative to now.
+	oldestNode, newestNode time.Time
+	now                    time.Time
+	// readyNodeCount have a True Ready condition; notReadyNodes are the
+	// rest, with the reason of their Ready condition.
+	readyNodeCount int
+	notReadyNodes  []notReadyNode
+	// hashNodeNames reports not-ready nodes by hashed name.
+	hashNodeNames bool
+	// Nodes with a True MemoryPressure, DiskPressure, or PIDPressure
+	// condition.
+	memoryPressureNodes, diskPressureNodes, pidPressureNodes int
+}
+
+// notReadyNode is one entry of notReadyNodes.
+type notReadyNode struct {
+	Node   string `json:"node"`
+	Reason string `json:"reason"`
+}
+
+func newNodeSummary() *nodeSummary {
+	return &nodeSummary{
+		now:               time.Now(),
+		osImages:          make(map[string]int),
+		osKernels:         make(map[string]map[string]bool),
+		selinuxNodes:      make(map[string]int),
+		containerRuntimes: make(map[string]int),
+		kubeletVersions:   make(map[string]int),
+		gpuResourceNames:  make(map[string]bool),
+		architectures:     make(map[string]int),
+		cloudProviders:    make(map[string]int),
+		podCIDRs:          make(map[netip.Prefix]bool),
+	}
+}
+
+func (s *nodeSummary) add(node *corev1.Node) {
+	cpu := node.Status.Allocatable.Cpu().MilliValue()
+	mem := node.Status.Allocatable.Memory().Value()
+	s.capacityCPU += node.Status.Capacity.Cpu().MilliValue()
+	s.capacityMemory += node.Status.Capacity.Memory().Value()
+	s.allocatableCPU += cpu
+	s.allocatableMemory += mem
+	if isControlPlaneNode(node) {
+		s.serverNodeCount++
+		if hasControlPlaneTaint(node) {
+			s.dedicatedControlPlaneNodes++
+		}
+		s.serverCPU += cpu
+		s.serverMemory += mem
+	} else {
+		s.agentNodeCount++
+		s.agentCPU += cpu
+		s.agentMemory += mem
+	}
+	if _, ok := node.Labels["node-role.kubernetes.io/etcd"]; ok {
+		s.etcdNodeCount++
+		if !isControlPlaneNode(node) {
+			s.etcdOnlyNodeCount++
+		}
+	}
+	if s.osImage == "" {
+		s.operatingSystem = node.Status.NodeInfo.OperatingSystem
+		s.osImage = node.Status.NodeInfo.OSImage
+		s.kernelVersion = node.Status.NodeInfo.KernelVersion
+		s.arch = node.Status.NodeInfo.Architecture
+	}
+	if image := node.Status.NodeInfo.OSImage; image != "" {
+		s.osImages[image]++
+		if s.osKernels[image] == nil {
+			s.osKernels[image] = make(map[string]bool)
+		}
+		if kernel := node.Status.NodeInfo.KernelVersion; kernel != "" {
+			s.osKernels[image][kernel] = true
+		}
+	}
+	if version := node.Status.NodeInfo.ContainerRuntimeVersion; version != "" {
+		s.containerRuntimes[version]++
+	}
+	if version := node.Status.NodeInfo.KubeletVersion; version != "" {
+		s.kubeletVersions[version]++
+	}
+	if arch := node.Status.NodeInfo.Architecture; arch != "" {
+		s.architectures[arch]++
+	}
+	s.cloudProviders[cloudProvider(node.Spec.ProviderID)]++
+	s.addPodCIDRs(node)
+	if created := node.CreationTimestamp.Time; !created.IsZero() {
+		if s.oldestNode.IsZero() || created.Before(s.oldestNode) {
+			s.oldestNode = created
+		}
+		if created.After(s.newestNode) {
+			s.newestNode = created
+		}
+	}
+	switch swap := node.Status.NodeInfo.Swap; {
+	case swap == nil || swap.Capacity == nil:
+		s.swapUnknownNodes++
+	case *swap.Capacity > 0:
+		s.swapEnabledNodes++
+	}
+	if ready, reason := nodeReady(node); ready {
+		s.readyNodeCount++
+	} else {
+		s.notReadyNodes = append(s.notReadyNodes, notReadyNode{Node: node.Name, Reason: reason})
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case corev1.NodeMemoryPressure:
+			s.memoryPressureNodes++
+		case corev1.NodeDiskPressure:
+			s.diskPressureNodes++
+		case corev1.NodePIDPressure:
+			s.pidPressureNodes++
+		}
+	}
+	selinux := getSELinuxStatus(node)
+	if s.selinuxInfo == "" {
+		s.selinuxInfo = selinux
+	}
+	s.selinuxNodes[selinux]++
+	var nodeGPUs int64
+	for _, res := range gpuResources {
+		if count := gpuCount(node, res); count > 0 {
+			nodeGPUs += count
+			s.gpuResourceNames[string(res)] = true
+			if s.gpuVendor == "" {
+				s.gpuVendor = gpuVendorMap[res]
+			}
+		}
+	}
+	if nodeGPUs > 0 {
+		s.gpuNodeCount++
+		s.totalGPUs += nodeGPUs
+	}
+}
+
+// nodeReady reports whether node's Ready condition is True and, if not, the
+// condition's reason. A node without the condition, such as one whose kubelet
+// has not yet reported, is not ready.
+func nodeReady(node *corev1.Node) (bool, string) {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type != corev1.NodeReady {
+			continue
+		}
+		if cond.Status == corev1.ConditionTrue {
+			return true, ""
+		}
+		if cond.Reason != "" {
+			return false, cond.Reason
+		}
+		return false, string(cond.Status)
+	}
+	return false, "NoReadyCondition"
+}
+
+// notReadyReport returns the not-ready nodes, by hashed name if
+// hashNodeNames is set, sorted by name.
+func (s *nodeSummary) notReadyReport() []notReadyNode {
+	nodes := make([]notReadyNode, 0, len(s.notReadyNodes))
+	for _, node := range s.notReadyNodes {
+		if s.hashNodeNames {
+			node.Node = hashName(node.Node)
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes
+}
+
+// cloudProvider returns the provider named by the scheme of a node's
+// provider ID, e.g. "aws" for "aws:///us-east-1a/i-0abc". Nodes without one,
+// or with the IDs that the RKE2 and K3s embedded cloud controllers assign
+// when no cloud provider is configured, report "none".
+func cloudProvider(providerID string) string {
+	if providerID == "" {
+		return "none"
+	}
+	scheme, _, ok := strings.Cut(providerID, "://")
+	if !ok || scheme == "" {
+		return "unknown"
+	}
+	switch scheme = strings.ToLower(scheme); scheme {
+	case "rke2", "k3s":
+		return "none"
+	}
+	return scheme
+}
+
+// addPodCIDRs records the node's pod CIDRs.
+func (s *nodeSummary) addPodCIDRs(node *corev1.Node) {
+	cidrs := node.Spec.PodCIDRs
+	if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+		cidrs = []string{node.Spec.PodCIDR}
+	}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			logrus.WithError(err).Debug("ignoring invalid node pod CIDR")
+			continue
+		}
+		s.podCIDRs[prefix.Masked()] = true
+	}
+}
+
+// gpuCount returns the number of res devices the node advertises, from its
+// capacity or, if that does not list res, its allocatable resources.
+func gpuCount(node *corev1.Node, res corev1.ResourceName) int64 {
+	qty, ok := node.Status.Capacity[res]
+	if !ok {
+		qty, ok = node.Status.Allocatable[res]
+	}
+	if !ok {
+		return 0
+	}
+	count, _ := qty.AsInt64()
+	return count
+}
+
+// report stores the summary in data, redacting counts in minimal mode.
+func (s *nodeSummary) report(data *Data, isMinimal bool) {
+	if isMinimal {
+		data.ExtraFieldInfo["serverNodeCount"] = -1
+		data.ExtraFieldInfo["agentNodeCount"] = -1
+		data.ExtraFieldInfo["gpuNodeCount"] = -1
+		data.ExtraFieldInfo["totalGpus"] = int64(-1)
+		data.ExtraFieldInfo["dedicatedControlPlaneNodes"] = -1
+		data.ExtraFieldInfo["schedulableControlPlaneNodes"] = -1
+		data.ExtraFieldInfo["etcdNodeCount"] = -1
+		data.ExtraFieldInfo["etcdOnlyNodeCount"] = -1
+		data.ExtraFieldInfo["etcdControlPlaneNodeCount"] = -1
+		data.ExtraFieldInfo["serverCPU"] = int64(-1)
+		data.ExtraFieldInfo["agentCPU"] = int64(-1)
+		data.ExtraFieldInfo["serverMemory"] = int64(-1)
+		data.ExtraFieldInfo["agentMemory"] = int64(-1)
+		data.ExtraFieldInfo["totalCpuCores"] = float64(-1)
+		data.ExtraFieldInfo["allocatableCpuCores"] = float64(-1)
+		data.ExtraFieldInfo["totalMemoryBytes"] = int64(-1)
+		data.ExtraFieldInfo["allocatableMemoryBytes"] = int64(-1)
+		data.ExtraFieldInfo["swapEnabledNodes"] = -1
+		data.ExtraFieldInfo["swapUnknownNodes"] = -1
+		data.ExtraFieldInfo["readyNodeCount"] = -1
+		data.ExtraFieldInfo["notReadyNodeCount"] = -1
+		data.ExtraFieldInfo["notReadyNodes"] = []notReadyNode{}
+		data.ExtraFieldInfo["memoryPressureNodes"] = -1
+		data.ExtraFieldInfo["diskPressureNodes"] = -1
+		data.ExtraFieldInfo["pidPressureNodes"] = -1
+	} else {
+		data.ExtraFieldInfo["serverNodeCount"] = s.serverNodeCount
+		data.ExtraFieldInfo["agentNodeCount"] = s.agentNodeCount
+		data.ExtraFieldInfo["dedicatedControlPlaneNodes"] = s.dedicatedControlPlaneNodes
+		data.ExtraFieldInfo["schedulableControlPlaneNodes"] = s.serverNodeCount - s.dedicatedControlPlaneNodes
+		data.ExtraFieldInfo["etcdNodeCount"] = s.etcdNodeCount
+		data.ExtraFieldInfo["etcdOnlyNodeCount"] = s.etcdOnlyNodeCount
+		data.ExtraFieldInfo["etcdControlPlaneNodeCount"] = s.etcdNodeCount - s.etcdOnlyNodeCount
+		data.ExtraFieldInfo["serverCPU"] = s.serverCPU
+		data.ExtraFieldInfo["agentCPU"] = s.agentCPU
+		data.ExtraFieldInfo["serverMemory"] = s.serverMemory
+		data.ExtraFieldInfo["agentMemory"] = s.agentMemory
+		data.ExtraFieldInfo["totalCpuCores"] = cores(s.capacityCPU)
+		data.ExtraFieldInfo["allocatableCpuCores"] = cores(s.allocatableCPU)
+		data.ExtraFieldInfo["totalMemoryBytes"] = s.capacityMemory
+		data.ExtraFieldInfo["allocatableMemoryBytes"] = s.allocatableMemory
+		data.ExtraFieldInfo["swapEnabledNodes"] = s.swapEnabledNodes
+		data.ExtraFieldInfo["swapUnknownNodes"] = s.swapUnknownNodes
+		data.ExtraFieldInfo["readyNodeCount"] = s.readyNodeCount
+		data.ExtraFieldInfo["notReadyNodeCount"] = len(s.notReadyNodes)
+		data.ExtraFieldInfo["notReadyNodes"] = s.notReadyReport()
+		data.ExtraFieldInfo["memoryPressureNodes"] = s.memoryPressureNodes
+		data.ExtraFieldInfo["diskPressureNodes"] = s.diskPressureNodes
+		data.ExtraFieldInfo["pidPressureNodes"] = s.pidPressureNodes
+		data.ExtraFieldInfo["gpuNodeCount"] = s.gpuNodeCount
+		data.ExtraFieldInfo["totalGpus"] = s.totalGPUs
+	}
+	data.ExtraFieldInfo["operating-system"] = s.operatingSystem
+	data.ExtraFieldInfo["os"] = s.osImage
+	data.ExtraFieldInfo["kernel"] = s.kernelVersion
+	if len(s.osImages) > 0 {
+		// Mixed clusters report the most common image rather than the first node's.
+		data.ExtraFieldInfo["os"] = mostCommon(s.osImages)
+		data.ExtraFieldInfo["osNormalized"] = normalizeOSImage(mostCommon(s.osImages))
+		data.ExtraFieldInfo["osDistribution"] = countsForMode(s.osImages, isMinimal)
+		kernels := make(map[string][]string, len(s.osKernels))
+		for image, set := range s.osKernels {
+			kernels[image] = sortedKeys(set)
+		}
+		data.ExtraFieldInfo["osKernels"] = kernels
+	}
+	data.ExtraFieldInfo["arch"] = s.arch
+	if len(s.architectures) > 0 {
+		data.ExtraFieldInfo["architectures"] = countsForMode(s.architectures, isMinimal)
+		data.ExtraFieldInfo["primaryArchitecture"] = mostCommon(s.architectures)
+	}
+	if len(s.cloudProviders) > 0 {
+		data.ExtraFieldInfo["cloudProviders"] = countsForMode(s.cloudProviders, isMinimal)
+		data.ExtraFieldInfo["cloudProvider"] = mostCommon(s.cloudProviders)
+	}
+	data.ExtraFieldInfo["selinux"] = s.selinuxInfo
+	if len(s.selinuxNodes) > 0 {
+		data.ExtraFieldInfo["selinuxNodes"] = countsForMode(s.selinuxNodes, isMinimal)
+	}
+	if len(s.containerRuntimes) > 0 {
+		data.ExtraFieldInfo["containerRuntime"] = mostCommon(s.containerRuntimes)
+		data.ExtraFieldInfo["containerRuntimes"] = countsForMode(s.containerRuntimes, isMinimal)
+	}
+	if len(s.kubeletVersions) > 0 {
+		data.ExtraFieldInfo["kubeletVersions"] = countsForMode(s.kubeletVersions, isMinimal)
+		// More than one kubelet version usually means an upgrade in progress or stalled.
+		data.ExtraFieldInfo["versionSkew"] = len(s.kubeletVersions) > 1
+	}
+	if len(s.podCIDRs) > 0 {
+		cidrs := []string{}
+		if !isMinimal {
+			prefixes := make([]netip.Prefix, 0, len(s.podCIDRs))
+			for prefix := range s.podCIDRs {
+				prefixes = append(prefixes, prefix)
+			}
+			// IPv4 sorts first, matching the order Kubernetes lists
+			// dual-stack ranges.
+			sort.Slice(prefixes, func(i, j int) bool {
+				if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+					return c < 0
+				}
+				return prefixes[i].Bits() < prefixes[j].Bits()
+			})
+			for _, prefix := range prefixes {
+				cidrs = append(cidrs, prefix.String())
+			}
+		}
+		data.ExtraFieldInfo["podCIDRs"] = cidrs
+	}
+	if !s.oldestNode.IsZero() {
+		if isMinimal {
+			data.ExtraFieldInfo["oldestNodeAge"] = int64(-1)
+			data.ExtraFieldInfo["newestNodeAge"] = int64(-1)
+		} else {
+			data.ExtraFieldInfo["oldestNodeAge"] = ageSeconds(s.now, s.oldestNode)
+			data.ExtraFieldInfo["newestNodeAge"] = ageSeconds(s.now, s.newestNode)
+		}
+	}
+	if s.gpuVendor != "" {
+		data.ExtraFieldInfo["gpu-vendor"] = s.gpuVendor
+		data.ExtraFieldInfo["gpuResources"] = sortedKeys(s.gpuResourceNames)
+	}
+	logrus.WithFields(logrus.Fields{
+		"server":       s.serverNodeCount,
+		"agent":        s.agentNodeCount,
+		"dedicated":    s.dedicatedControlPlaneNodes,
+		"etcd":         s.etcdNodeCount,
+		"serverCPU":    s.serverCPU,
+		"agentCPU":     s.agentCPU,
+		"serverMemory": s.serverMemory,
+		"agentMemory":  s.agentMemory,
+		"gpuNodeCount": s.gpuNodeCount,
+		"totalGPUs":    s.totalGPUs,
+		"notReady":     len(s.notReadyNodes),
+	}).Debug("collected nodes")
+}
+
+// hasControlPlaneTaint reports whether node carries a NoSchedule or NoExecute
+// taint that reserves it for the control plane.
+func hasControlPlaneTaint(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if controlPlaneTaints[taint.Key] && (taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute) {
+			return true
+		}
+	}
+	return false
+}
+
+// cores converts millicores to cores, keeping fractional allocatable CPU
+// such as 3800m.
+func cores(milli int64) float64 {
+	return float64(milli) / 1000
+}
+
+// ageSeconds returns the whole seconds from t to now, or 0 if t is in the
+// future because of clock skew.
+func ageSeconds(now, t time.Time) int64 {
+	return max(int64(now.Sub(t)/time.Second), 0)
+}
+
+// mostCommon returns the key with the highest count, breaking ties by name so
+// that repeated runs report the same value.
+func mostCommon(counts map[string]int) string {
+	best, bestCount := "", 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && key < best) {
+			best, bestCount = key, count
+		}
+	}
+	return best
+}
+
+// countsForMode returns counts unchanged, or with every count replaced by -1
+// in minimal mode so that the distinct values are kept but node counts are not.
+func countsForMode(counts map[string]int, isMinimal bool) map[string]int {
+	if !isMinimal {
+		return counts
+	}
+	redacted := make(map[string]int, len(counts))
+	for key := range counts {
+		redacted[key] = -1
+	}
+	return redacted
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// osImagePatterns map OS image strings to canonical identifiers, matched in
+// order so that more specific names come first. The first group is the major
+// version and the optional second group the minor version (the service pack
+// for SLES).
+var osImagePatterns = []struct {
+	re *regexp.Regexp
+	id string
+}{
+	{regexp.MustCompile(`^SUSE Linux Enterprise Server (\d+)(?: SP(\d+))?`), "sles"},
+	{regexp.MustCompile(`^(?:SLE Micro|SL Micro|SUSE Linux Micro|SUSE Linux Enterprise Micro) (\d+)(?:\.(\d+))?`), "sle-micro"},
+	{regexp.MustCompile(`^openSUSE Leap Micro (\d+)(?:\.(\d+))?`), "opensuse-leap-micro"},
+	{regexp.MustCompile(`^openSUSE Leap (\d+)(?:\.(\d+))?`), "opensuse-leap"},
+	{regexp.MustCompile(`^Ubuntu (\d+)(?:\.(\d+))?`), "ubuntu"},
+	{regexp.MustCompile(`^Debian GNU/Linux (\d+)(?:\.(\d+))?`), "debian"},
+	{regexp.MustCompile(`^Red Hat Enterprise Linux(?: Server| CoreOS)? (\d+)(?:\.(\d+))?`), "rhel"},
+	{regexp.MustCompile(`^Rocky Linux (\d+)(?:\.(\d+))?`), "rocky"},
+	{regexp.MustCompile(`^AlmaLinux (\d+)(?:\.(\d+))?`), "almalinux"},
+	{regexp.MustCompile(`^CentOS Stream (\d+)`), "centos-stream"},
+	{regexp.MustCompile(`^CentOS Linux (\d+)(?:\.(\d+))?`), "centos"},
+	{regexp.MustCompile(`^Oracle Linux Server (\d+)(?:\.(\d+))?`), "oracle"},
+	{regexp.MustCompile(`^Fedora(?: Linux)? (\d+)`), "fedora"},
+	{regexp.MustCompile(`^Amazon Linux (\d+)`), "amzn"},
+	{regexp.MustCompile(`^Flatcar Container Linux by Kinvolk (\d+)(?:\.(\d+))?`), "flatcar"},
+	{regexp.MustCompile(`^Windows Server (\d+)`), "windows"},
+}
+
+// osRollingReleases have no version to extract.
+var osRollingReleases = map[string]string{
+	"openSUSE Tumbleweed": "opensuse-tumbleweed",
+}
+
+// normalizeOSImage maps an OS image such as "SUSE Linux Enterprise Server 15
+// SP5" to a canonical identifier such as "sles-15.5". Unrecognized images are
+// returned with a "raw:" prefix so they are never mistaken for canonical ones.
+func normalizeOSImage(image string) string {
+	for prefix, id := range osRollingReleases {
+		if strings.HasPrefix(image, prefix) {
+			return id
+		}
+	}
+	for _, p := range osImagePatterns {
+		m := p.re.FindStringSubmatch(image)
+		if m == nil {
+			continue
+		}
+		version := m[1]
+		if len(m) > 2 && m[2] != "" {
+			version += "." + m[2]
+		}
+		return p.id + "-" + version
+	}
+	return "raw:" + image
+}
@@ -0,0 +1,918 @@
+package telemetry
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCollect_PaginatedNodes(t *testing.T) {
+	node := func(name string, controlPlane bool) corev1.Node {
+		n := corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+			Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: "SLE Micro 6.1", Architecture: "amd64"}},
+		}
+		if controlPlane {
+			n.Labels["node-role.kubernetes.io/control-plane"] = "true"
+		}
+		return n
+	}
+	pages := []*corev1.NodeList{
+		{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []corev1.Node{node("server-1", true), node("agent-1", false)}},
+		{ListMeta: metav1.ListMeta{Continue: "page-3"}, Items: []corev1.Node{node("agent-2", false)}},
+		{Items: []corev1.Node{node("agent-3", false)}},
+	}
+
+	clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+	var calls int
+	clientset.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// Label-selected lookups, such as the CIS profile check, are not paged.
+		if !action.(k8stesting.ListAction).GetListRestrictions().Labels.Empty() {
+			return false, nil, nil
+		}
+		page := pages[calls]
+		calls++
+		return true, page, nil
+	})
+
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", NodePageSize: 2})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	if calls != len(pages) {
+		t.Errorf("node list calls = %d, want %d", calls, len(pages))
+	}
+	if data.ExtraFieldInfo["serverNodeCount"] != 1 {
+		t.Errorf("serverNodeCount = %v, want 1", data.ExtraFieldInfo["serverNodeCount"])
+	}
+	if data.ExtraFieldInfo["agentNodeCount"] != 3 {
+		t.Errorf("agentNodeCount = %v, want 3", data.ExtraFieldInfo["agentNodeCount"])
+	}
+	if data.ExtraFieldInfo["os"] != "SLE Micro 6.1" {
+		t.Errorf("os = %v, want SLE Micro 6.1", data.ExtraFieldInfo["os"])
+	}
+}
+
+func TestCollect_NodeSelector(t *testing.T) {
+	node := func(name, tenant string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"tenant": tenant}}}
+	}
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		node("a-1", "a"),
+		node("a-2", "a"),
+		node("b-1", "b"),
+	}
+
+	tests := []struct {
+		name        string
+		selector    string
+		wantAgents  int
+		wantApplied interface{}
+	}{
+		{"unset", "", 3, nil},
+		{"tenant a", "tenant=a", 2, true},
+		{"no match", "tenant=c", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Collect(context.Background(), fake.NewClientset(objects...), CollectOptions{Mode: "recommended", NodeSelector: tt.selector})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if got := data.ExtraFieldInfo["agentNodeCount"]; got != tt.wantAgents {
+				t.Errorf("agentNodeCount = %v, want %d", got, tt.wantAgents)
+			}
+			if got := data.ExtraFieldInfo["nodeSelectorApplied"]; got != tt.wantApplied {
+				t.Errorf("nodeSelectorApplied = %v, want %v", got, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_OSDistribution(t *testing.T) {
+	node := func(osImage, kernel string) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: osImage, KernelVersion: kernel}}}
+	}
+
+	tests := []struct {
+		name        string
+		isMinimal   bool
+		wantOS      string
+		wantDist    map[string]int
+		wantKernels map[string][]string
+	}{
+		{
+			name:        "recommended",
+			wantOS:      "Ubuntu 22.04.4 LTS",
+			wantDist:    map[string]int{"SUSE Linux Enterprise Server 15 SP5": 1, "Ubuntu 22.04.4 LTS": 2},
+			wantKernels: map[string][]string{"SUSE Linux Enterprise Server 15 SP5": {"5.14.21"}, "Ubuntu 22.04.4 LTS": {"5.15.0-100", "5.15.0-91"}},
+		},
+		{
+			name:        "minimal",
+			isMinimal:   true,
+			wantOS:      "Ubuntu 22.04.4 LTS",
+			wantDist:    map[string]int{"SUSE Linux Enterprise Server 15 SP5": -1, "Ubuntu 22.04.4 LTS": -1},
+			wantKernels: map[string][]string{"SUSE Linux Enterprise Server 15 SP5": {"5.14.21"}, "Ubuntu 22.04.4 LTS": {"5.15.0-100", "5.15.0-91"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			s.add(node("SUSE Linux Enterprise Server 15 SP5", "5.14.21"))
+			s.add(node("Ubuntu 22.04.4 LTS", "5.15.0-91"))
+			s.add(node("Ubuntu 22.04.4 LTS", "5.15.0-100"))
+
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if data.ExtraFieldInfo["os"] != tt.wantOS {
+				t.Errorf("os = %v, want %v", data.ExtraFieldInfo["os"], tt.wantOS)
+			}
+			if !reflect.DeepEqual(data.ExtraFieldInfo["osDistribution"], tt.wantDist) {
+				t.Errorf("osDistribution = %v, want %v", data.ExtraFieldInfo["osDistribution"], tt.wantDist)
+			}
+			if !reflect.DeepEqual(data.ExtraFieldInfo["osKernels"], tt.wantKernels) {
+				t.Errorf("osKernels = %v, want %v", data.ExtraFieldInfo["osKernels"], tt.wantKernels)
+			}
+		})
+	}
+}
+
+func TestMostCommon(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts map[string]int
+		want   string
+	}{
+		{"empty", map[string]int{}, ""},
+		{"single", map[string]int{"a": 1}, "a"},
+		{"highest", map[string]int{"a": 1, "b": 3, "c": 2}, "b"},
+		{"tie broken by name", map[string]int{"b": 2, "a": 2}, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mostCommon(tt.counts); got != tt.want {
+				t.Errorf("mostCommon() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_SELinuxNodes(t *testing.T) {
+	s := newNodeSummary()
+	s.add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"security.alpha.kubernetes.io/selinux": "enabled"}}})
+	s.add(&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: "Rocky Linux 9.3"}}})
+	s.add(&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: "Ubuntu 22.04.4 LTS"}}})
+	s.add(&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: "Ubuntu 22.04.4 LTS"}}})
+
+	data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+	s.report(data, false)
+
+	want := map[string]int{"enabled": 1, "likely-enabled": 1, "unknown": 2}
+	if !reflect.DeepEqual(data.ExtraFieldInfo["selinuxNodes"], want) {
+		t.Errorf("selinuxNodes = %v, want %v", data.ExtraFieldInfo["selinuxNodes"], want)
+	}
+}
+
+func TestNodeSummary_ContainerRuntimes(t *testing.T) {
+	node := func(version string) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{ContainerRuntimeVersion: version}}}
+	}
+
+	tests := []struct {
+		name         string
+		runtimes     []string
+		isMinimal    bool
+		wantRuntime  interface{}
+		wantRuntimes interface{}
+	}{
+		{
+			name:         "mixed",
+			runtimes:     []string{"containerd://1.7.27-k3s1", "containerd://1.7.27-k3s1", "containerd://1.7.23-k3s2"},
+			wantRuntime:  "containerd://1.7.27-k3s1",
+			wantRuntimes: map[string]int{"containerd://1.7.27-k3s1": 2, "containerd://1.7.23-k3s2": 1},
+		},
+		{
+			name:         "minimal",
+			runtimes:     []string{"containerd://1.7.27-k3s1", "containerd://1.7.23-k3s2"},
+			isMinimal:    true,
+			wantRuntime:  "containerd://1.7.23-k3s2",
+			wantRuntimes: map[string]int{"containerd://1.7.27-k3s1": -1, "containerd://1.7.23-k3s2": -1},
+		},
+		{
+			name:     "not reported",
+			runtimes: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, version := range tt.runtimes {
+				s.add(node(version))
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["containerRuntime"]; got != tt.wantRuntime {
+				t.Errorf("containerRuntime = %v, want %v", got, tt.wantRuntime)
+			}
+			if got := data.ExtraFieldInfo["containerRuntimes"]; !reflect.DeepEqual(got, tt.wantRuntimes) {
+				t.Errorf("containerRuntimes = %v, want %v", got, tt.wantRuntimes)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_KubeletVersions(t *testing.T) {
+	node := func(version string) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: version}}}
+	}
+
+	tests := []struct {
+		name         string
+		versions     []string
+		wantVersions interface{}
+		wantSkew     interface{}
+	}{
+		{
+			name:         "uniform",
+			versions:     []string{"v1.32.2+rke2r1", "v1.32.2+rke2r1"},
+			wantVersions: map[string]int{"v1.32.2+rke2r1": 2},
+			wantSkew:     false,
+		},
+		{
+			name:         "mid-upgrade",
+			versions:     []string{"v1.32.2+rke2r1", "v1.31.6+rke2r1", "v1.31.6+rke2r1"},
+			wantVersions: map[string]int{"v1.32.2+rke2r1": 1, "v1.31.6+rke2r1": 2},
+			wantSkew:     true,
+		},
+		{
+			name:     "not reported",
+			versions: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, version := range tt.versions {
+				s.add(node(version))
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, false)
+
+			if got := data.ExtraFieldInfo["kubeletVersions"]; !reflect.DeepEqual(got, tt.wantVersions) {
+				t.Errorf("kubeletVersions = %v, want %v", got, tt.wantVersions)
+			}
+			if got := data.ExtraFieldInfo["versionSkew"]; got != tt.wantSkew {
+				t.Errorf("versionSkew = %v, want %v", got, tt.wantSkew)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_ControlPlaneTaints(t *testing.T) {
+	node := func(controlPlane bool, taints ...corev1.Taint) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}, Spec: corev1.NodeSpec{Taints: taints}}
+		if controlPlane {
+			n.Labels["node-role.kubernetes.io/control-plane"] = "true"
+		}
+		return n
+	}
+	taint := func(key string, effect corev1.TaintEffect) corev1.Taint {
+		return corev1.Taint{Key: key, Effect: effect}
+	}
+
+	s := newNodeSummary()
+	s.add(node(true, taint("node-role.kubernetes.io/control-plane", corev1.TaintEffectNoSchedule)))
+	s.add(node(true, taint("CriticalAddonsOnly", corev1.TaintEffectNoExecute)))
+	s.add(node(true, taint("node-role.kubernetes.io/control-plane", corev1.TaintEffectPreferNoSchedule)))
+	s.add(node(true))
+	// Agents are not counted, even when tainted.
+	s.add(node(false, taint("node-role.kubernetes.io/control-plane", corev1.TaintEffectNoSchedule)))
+
+	tests := []struct {
+		name            string
+		isMinimal       bool
+		wantDedicated   int
+		wantSchedulable int
+	}{
+		{"recommended", false, 2, 2},
+		{"minimal", true, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+			if got := data.ExtraFieldInfo["dedicatedControlPlaneNodes"]; got != tt.wantDedicated {
+				t.Errorf("dedicatedControlPlaneNodes = %v, want %d", got, tt.wantDedicated)
+			}
+			if got := data.ExtraFieldInfo["schedulableControlPlaneNodes"]; got != tt.wantSchedulable {
+				t.Errorf("schedulableControlPlaneNodes = %v, want %d", got, tt.wantSchedulable)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_EtcdNodes(t *testing.T) {
+	node := func(roles ...string) *corev1.Node {
+		labels := map[string]string{}
+		for _, role := range roles {
+			labels["node-role.kubernetes.io/"+role] = "true"
+		}
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+	}
+
+	s := newNodeSummary()
+	s.add(node("control-plane", "etcd", "master"))
+	s.add(node("control-plane", "etcd"))
+	s.add(node("etcd"))
+	s.add(node("control-plane"))
+	s.add(node())
+
+	tests := []struct {
+		name      string
+		isMinimal bool
+		want      map[string]int
+	}{
+		{"recommended", false, map[string]int{"etcdNodeCount": 3, "etcdOnlyNodeCount": 1, "etcdControlPlaneNodeCount": 2}},
+		{"minimal", true, map[string]int{"etcdNodeCount": -1, "etcdOnlyNodeCount": -1, "etcdControlPlaneNodeCount": -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+			for key, want := range tt.want {
+				if got := data.ExtraFieldInfo[key]; got != want {
+					t.Errorf("%s = %v, want %d", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeSummary_GPUs(t *testing.T) {
+	node := func(capacity, allocatable corev1.ResourceList) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{Capacity: capacity, Allocatable: allocatable}}
+	}
+
+	tests := []struct {
+		name          string
+		nodes         []*corev1.Node
+		wantNodes     int
+		wantTotal     int64
+		wantResources interface{}
+	}{
+		{
+			name: "mixed accelerators",
+			nodes: []*corev1.Node{
+				node(corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("4")}, nil),
+				node(corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("2")}, nil),
+				node(corev1.ResourceList{"gpu.intel.com/i915": resource.MustParse("1")}, nil),
+				node(corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("0")}, nil),
+				node(nil, nil),
+			},
+			wantNodes:     3,
+			wantTotal:     7,
+			wantResources: []string{"gpu.intel.com/i915", "nvidia.com/gpu"},
+		},
+		{
+			name:          "allocatable only",
+			nodes:         []*corev1.Node{node(nil, corev1.ResourceList{"amd.com/gpu": resource.MustParse("8")})},
+			wantNodes:     1,
+			wantTotal:     8,
+			wantResources: []string{"amd.com/gpu"},
+		},
+		{
+			name:  "no GPUs",
+			nodes: []*corev1.Node{node(nil, nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, n := range tt.nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, false)
+
+			if got := data.ExtraFieldInfo["gpuNodeCount"]; got != tt.wantNodes {
+				t.Errorf("gpuNodeCount = %v, want %d", got, tt.wantNodes)
+			}
+			if got := data.ExtraFieldInfo["totalGpus"]; got != tt.wantTotal {
+				t.Errorf("totalGpus = %v, want %d", got, tt.wantTotal)
+			}
+			if got := data.ExtraFieldInfo["gpuResources"]; !reflect.DeepEqual(got, tt.wantResources) {
+				t.Errorf("gpuResources = %v, want %v", got, tt.wantResources)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_Architectures(t *testing.T) {
+	node := func(arch string) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{Architecture: arch}}}
+	}
+
+	tests := []struct {
+		name        string
+		archs       []string
+		isMinimal   bool
+		wantArchs   interface{}
+		wantPrimary interface{}
+	}{
+		{
+			name:        "mixed",
+			archs:       []string{"arm64", "amd64", "amd64"},
+			wantArchs:   map[string]int{"amd64": 2, "arm64": 1},
+			wantPrimary: "amd64",
+		},
+		{
+			name:        "minimal",
+			archs:       []string{"arm64", "amd64", "arm64"},
+			isMinimal:   true,
+			wantArchs:   map[string]int{"amd64": -1, "arm64": -1},
+			wantPrimary: "arm64",
+		},
+		{
+			name:  "not reported",
+			archs: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, arch := range tt.archs {
+				s.add(node(arch))
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["architectures"]; !reflect.DeepEqual(got, tt.wantArchs) {
+				t.Errorf("architectures = %v, want %v", got, tt.wantArchs)
+			}
+			if got := data.ExtraFieldInfo["primaryArchitecture"]; got != tt.wantPrimary {
+				t.Errorf("primaryArchitecture = %v, want %v", got, tt.wantPrimary)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_PodCIDRs(t *testing.T) {
+	node := func(cidrs ...string) *corev1.Node {
+		n := &corev1.Node{Spec: corev1.NodeSpec{PodCIDRs: cidrs}}
+		if len(cidrs) > 0 {
+			n.Spec.PodCIDR = cidrs[0]
+		}
+		return n
+	}
+
+	tests := []struct {
+		name      string
+		nodes     []*corev1.Node
+		isMinimal bool
+		want      interface{}
+	}{
+		{
+			name:  "single node",
+			nodes: []*corev1.Node{node("10.42.0.0/24")},
+			want:  []string{"10.42.0.0/24"},
+		},
+		{
+			name:  "sorted and de-duplicated",
+			nodes: []*corev1.Node{node("10.42.3.0/24"), node("10.42.1.0/24"), node("10.42.0.0/24"), node("10.42.1.0/24")},
+			want:  []string{"10.42.0.0/24", "10.42.1.0/24", "10.42.3.0/24"},
+		},
+		{
+			name:  "separate ranges",
+			nodes: []*corev1.Node{node("10.200.0.0/24"), node("10.42.0.0/24")},
+			want:  []string{"10.42.0.0/24", "10.200.0.0/24"},
+		},
+		{
+			name:  "dual-stack",
+			nodes: []*corev1.Node{node("10.42.0.0/24", "2001:cafe:42::/64"), node("10.42.1.0/24", "2001:cafe:42:1::/64")},
+			want:  []string{"10.42.0.0/24", "10.42.1.0/24", "2001:cafe:42::/64", "2001:cafe:42:1::/64"},
+		},
+		{
+			name:  "legacy field only",
+			nodes: []*corev1.Node{{Spec: corev1.NodeSpec{PodCIDR: "10.42.0.0/24"}}},
+			want:  []string{"10.42.0.0/24"},
+		},
+		{
+			name:  "invalid ignored",
+			nodes: []*corev1.Node{node("not-a-cidr"), node("10.42.2.0/24")},
+			want:  []string{"10.42.2.0/24"},
+		},
+		{
+			name:      "minimal",
+			nodes:     []*corev1.Node{node("10.42.0.0/24")},
+			isMinimal: true,
+			want:      []string{},
+		},
+		{
+			name:  "not assigned",
+			nodes: []*corev1.Node{node()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, n := range tt.nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["podCIDRs"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podCIDRs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_NodeAges(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	node := func(age time.Duration) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-age))}}
+	}
+
+	tests := []struct {
+		name       string
+		nodes      []*corev1.Node
+		isMinimal  bool
+		wantOldest interface{}
+		wantNewest interface{}
+	}{
+		{
+			name:       "mixed ages",
+			nodes:      []*corev1.Node{node(48 * time.Hour), node(90 * 24 * time.Hour), node(time.Hour)},
+			wantOldest: int64(90 * 24 * 3600),
+			wantNewest: int64(3600),
+		},
+		{
+			name:       "minimal",
+			nodes:      []*corev1.Node{node(48 * time.Hour)},
+			isMinimal:  true,
+			wantOldest: int64(-1),
+			wantNewest: int64(-1),
+		},
+		{
+			name:       "clock skew",
+			nodes:      []*corev1.Node{node(-time.Minute)},
+			wantOldest: int64(0),
+			wantNewest: int64(0),
+		},
+		{
+			name:  "no timestamps",
+			nodes: []*corev1.Node{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			s.now = now
+			for _, n := range tt.nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["oldestNodeAge"]; got != tt.wantOldest {
+				t.Errorf("oldestNodeAge = %v, want %v", got, tt.wantOldest)
+			}
+			if got := data.ExtraFieldInfo["newestNodeAge"]; got != tt.wantNewest {
+				t.Errorf("newestNodeAge = %v, want %v", got, tt.wantNewest)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_ClusterCapacity(t *testing.T) {
+	node := func(capacityCPU, capacityMemory, allocatableCPU, allocatableMemory string) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(capacityCPU),
+				corev1.ResourceMemory: resource.MustParse(capacityMemory),
+			},
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(allocatableCPU),
+				corev1.ResourceMemory: resource.MustParse(allocatableMemory),
+			},
+		}}
+	}
+	nodes := []*corev1.Node{
+		node("4", "16Gi", "3800m", "15Gi"),
+		node("2", "8000000Ki", "1500m", "7000Mi"),
+		node("500m", "1G", "250m", "512M"),
+	}
+
+	tests := []struct {
+		name      string
+		isMinimal bool
+		want      map[string]interface{}
+	}{
+		{
+			name: "recommended",
+			want: map[string]interface{}{
+				"totalCpuCores":          6.5,
+				"allocatableCpuCores":    5.55,
+				"totalMemoryBytes":       int64(16<<30 + 8000000<<10 + 1000000000),
+				"allocatableMemoryBytes": int64(15<<30 + 7000<<20 + 512000000),
+			},
+		},
+		{
+			name:      "minimal",
+			isMinimal: true,
+			want: map[string]interface{}{
+				"totalCpuCores":          float64(-1),
+				"allocatableCpuCores":    float64(-1),
+				"totalMemoryBytes":       int64(-1),
+				"allocatableMemoryBytes": int64(-1),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, n := range nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			for key, want := range tt.want {
+				if got := data.ExtraFieldInfo[key]; got != want {
+					t.Errorf("%s = %v (%T), want %v (%T)", key, got, got, want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeSummary_Swap(t *testing.T) {
+	node := func(swap *corev1.NodeSwapStatus) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{Swap: swap}}}
+	}
+	capacity := func(bytes int64) *corev1.NodeSwapStatus {
+		return &corev1.NodeSwapStatus{Capacity: &bytes}
+	}
+	nodes := []*corev1.Node{
+		node(capacity(4 << 30)),
+		node(capacity(0)),
+		node(nil),
+		node(&corev1.NodeSwapStatus{}),
+	}
+
+	tests := []struct {
+		name        string
+		isMinimal   bool
+		wantEnabled int
+		wantUnknown int
+	}{
+		{"recommended", false, 1, 2},
+		{"minimal", true, -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, n := range nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["swapEnabledNodes"]; got != tt.wantEnabled {
+				t.Errorf("swapEnabledNodes = %v, want %d", got, tt.wantEnabled)
+			}
+			if got := data.ExtraFieldInfo["swapUnknownNodes"]; got != tt.wantUnknown {
+				t.Errorf("swapUnknownNodes = %v, want %d", got, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_Readiness(t *testing.T) {
+	node := func(name string, conditions ...corev1.NodeCondition) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{Conditions: conditions},
+		}
+	}
+	ready := func(status corev1.ConditionStatus, reason string) corev1.NodeCondition {
+		return corev1.NodeCondition{Type: corev1.NodeReady, Status: status, Reason: reason}
+	}
+	nodes := []*corev1.Node{
+		node("server-0", ready(corev1.ConditionTrue, "KubeletReady")),
+		node("agent-1", ready(corev1.ConditionFalse, "KubeletNotReady")),
+		node("agent-0", ready(corev1.ConditionUnknown, "NodeStatusUnknown")),
+		node("agent-2", corev1.NodeCondition{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse}),
+	}
+
+	tests := []struct {
+		name         string
+		isMinimal    bool
+		hash         bool
+		wantReady    int
+		wantNotReady int
+		want         []notReadyNode
+	}{
+		{"recommended", false, false, 1, 3, []notReadyNode{
+			{"agent-0", "NodeStatusUnknown"},
+			{"agent-1", "KubeletNotReady"},
+			{"agent-2", "NoReadyCondition"},
+		}},
+		{"hashed names", false, true, 1, 3, nil},
+		{"minimal", true, false, -1, -1, []notReadyNode{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			s.hashNodeNames = tt.hash
+			for _, n := range nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["readyNodeCount"]; got != tt.wantReady {
+				t.Errorf("readyNodeCount = %v, want %d", got, tt.wantReady)
+			}
+			if got := data.ExtraFieldInfo["notReadyNodeCount"]; got != tt.wantNotReady {
+				t.Errorf("notReadyNodeCount = %v, want %d", got, tt.wantNotReady)
+			}
+			got := data.ExtraFieldInfo["notReadyNodes"].([]notReadyNode)
+			if tt.hash {
+				for _, entry := range got {
+					if len(entry.Node) != nameHashLength || strings.Contains(entry.Node, "agent") {
+						t.Errorf("node = %q, want a %d-digit hash", entry.Node, nameHashLength)
+					}
+				}
+				if len(got) != tt.wantNotReady {
+					t.Errorf("notReadyNodes = %v, want %d entries", got, tt.wantNotReady)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notReadyNodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeSummary_PressureConditions(t *testing.T) {
+	node := func(conditions map[corev1.NodeConditionType]corev1.ConditionStatus) *corev1.Node {
+		n := &corev1.Node{}
+		for condType, status := range conditions {
+			n.Status.Conditions = append(n.Status.Conditions, corev1.NodeCondition{Type: condType, Status: status})
+		}
+		return n
+	}
+	nodes := []*corev1.Node{
+		node(map[corev1.NodeConditionType]corev1.ConditionStatus{corev1.NodeMemoryPressure: corev1.ConditionTrue, corev1.NodeDiskPressure: corev1.ConditionTrue}),
+		node(map[corev1.NodeConditionType]corev1.ConditionStatus{corev1.NodeDiskPressure: corev1.ConditionTrue, corev1.NodePIDPressure: corev1.ConditionFalse}),
+		node(map[corev1.NodeConditionType]corev1.ConditionStatus{corev1.NodePIDPressure: corev1.ConditionUnknown}),
+		node(nil),
+	}
+
+	tests := []struct {
+		name      string
+		isMinimal bool
+		want      map[string]int
+	}{
+		{"recommended", false, map[string]int{"memoryPressureNodes": 1, "diskPressureNodes": 2, "pidPressureNodes": 0}},
+		{"minimal", true, map[string]int{"memoryPressureNodes": -1, "diskPressureNodes": -1, "pidPressureNodes": -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, n := range nodes {
+				s.add(n)
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			for key, want := range tt.want {
+				if got := data.ExtraFieldInfo[key]; got != want {
+					t.Errorf("%s = %v, want %d", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeSummary_CloudProvider(t *testing.T) {
+	node := func(providerID string) *corev1.Node {
+		return &corev1.Node{Spec: corev1.NodeSpec{ProviderID: providerID}}
+	}
+
+	tests := []struct {
+		name        string
+		providerIDs []string
+		isMinimal   bool
+		wantPrimary string
+		wantCounts  map[string]int
+	}{
+		{
+			name:        "bare metal",
+			providerIDs: []string{"", "rke2://server-1", "k3s://agent-1"},
+			wantPrimary: "none",
+			wantCounts:  map[string]int{"none": 3},
+		},
+		{
+			name:        "mixed",
+			providerIDs: []string{"aws:///us-east-1a/i-0abc", "aws:///us-east-1b/i-0def", "gce://project/zone/vm", "", "bogus"},
+			wantPrimary: "aws",
+			wantCounts:  map[string]int{"aws": 2, "gce": 1, "none": 1, "unknown": 1},
+		},
+		{
+			name:        "minimal",
+			providerIDs: []string{"azure:///subscriptions/s/vm-0", "vsphere://4211b3c1"},
+			isMinimal:   true,
+			wantPrimary: "azure",
+			wantCounts:  map[string]int{"azure": -1, "vsphere": -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNodeSummary()
+			for _, id := range tt.providerIDs {
+				s.add(node(id))
+			}
+			data := &Data{ExtraFieldInfo: map[string]interface{}{}}
+			s.report(data, tt.isMinimal)
+
+			if got := data.ExtraFieldInfo["cloudProvider"]; got != tt.wantPrimary {
+				t.Errorf("cloudProvider = %v, want %s", got, tt.wantPrimary)
+			}
+			if got := data.ExtraFieldInfo["cloudProviders"]; !reflect.DeepEqual(got, tt.wantCounts) {
+				t.Errorf("cloudProviders = %v, want %v", got, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestNormalizeOSImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"SUSE Linux Enterprise Server 15 SP5", "sles-15.5"},
+		{"SUSE Linux Enterprise Server 15", "sles-15"},
+		{"SLE Micro 6.1", "sle-micro-6.1"},
+		{"SUSE Linux Micro 6.0", "sle-micro-6.0"},
+		{"SUSE Linux Enterprise Micro 5.5", "sle-micro-5.5"},
+		{"openSUSE Leap Micro 5.5", "opensuse-leap-micro-5.5"},
+		{"openSUSE Leap 15.6", "opensuse-leap-15.6"},
+		{"openSUSE Tumbleweed", "opensuse-tumbleweed"},
+		{"Ubuntu 22.04.4 LTS", "ubuntu-22.04"},
+		{"Debian GNU/Linux 12 (bookworm)", "debian-12"},
+		{"Red Hat Enterprise Linux 9.4 (Plow)", "rhel-9.4"},
+		{"Red Hat Enterprise Linux 9", "rhel-9"},
+		{"Rocky Linux 9.3 (Blue Onyx)", "rocky-9.3"},
+		{"AlmaLinux 8.10 (Cerulean Leopard)", "almalinux-8.10"},
+		{"CentOS Stream 9", "centos-stream-9"},
+		{"CentOS Linux 7 (Core)", "centos-7"},
+		{"Oracle Linux Server 8.9", "oracle-8.9"},
+		{"Fedora Linux 39 (Cloud Edition)", "fedora-39"},
+		{"Amazon Linux 2023", "amzn-2023"},
+		{"Flatcar Container Linux by Kinvolk 3760.2.0 (Oklo)", "flatcar-3760.2"},
+		{"Windows Server 2022 Datacenter", "windows-2022"},
+		{"Talos (v1.7.0)", "raw:Talos (v1.7.0)"},
+		{"", "raw:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := normalizeOSImage(tt.image); got != tt.want {
+				t.Errorf("normalizeOSImage(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
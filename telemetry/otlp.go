@@ -0,0 +1,227 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Payload formats for SendOptions.Format.
+const (
+	// FormatJSON is the responder's own JSON body, expected by the security
+	// check endpoint.
+	FormatJSON = "json"
+	// FormatOTLP is an OTLP/HTTP JSON metrics export, for sending to an
+	// OpenTelemetry collector's /v1/metrics endpoint.
+	FormatOTLP = "otlp"
+	// FormatRemoteWrite is a Prometheus remote-write v1 request, for sending
+	// to a receiver's remote-write endpoint.
+	FormatRemoteWrite = "remote-write"
+	// FormatGRPC streams a Report message (see telemetrypb/telemetry.proto) to a gRPC
+	// Ingest service instead of using HTTP.
+	FormatGRPC = "grpc"
+)
+
+// otlpScope names the instrumentation scope of exported metrics.
+const otlpScope = "github.com/rancher/rke2-security-responder/telemetry"
+
+// marshalPayload encodes data in the given format; an empty format is FormatJSON.
+// Remote-write bodies are already snappy-compressed.
+func marshalPayload(data *Data, format string, now time.Time) ([]byte, error) {
+	switch format {
+	case "", FormatJSON:
+		return json.Marshal(data)
+	case FormatOTLP:
+		return json.Marshal(otlpMetrics(data, now))
+	case FormatRemoteWrite:
+		return marshalRemoteWrite(data, now), nil
+	case FormatGRPC:
+		return marshalReport(data)
+	default:
+		return nil, fmt.Errorf("unknown payload format %q", format)
+	}
+}
+
+// The types below are the subset of the OTLP JSON encoding
+// (ExportMetricsServiceRequest) needed for gauges with resource attributes.
+// 64-bit integers are encoded as strings, as the encoding requires.
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpInstrumentationScope `json:"scope"`
+	Metrics []otlpMetric             `json:"metrics"`
+}
+
+type otlpInstrumentationScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string    `json:"name"`
+	Gauge otlpGauge `json:"gauge"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	TimeUnixNano string   `json:"timeUnixNano"`
+	AsInt        string   `json:"asInt,omitempty"`
+	AsDouble     *float64 `json:"asDouble,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// otlpMetrics maps data to a single resource: tags, the app and schema
+// versions, and non-numeric fields become resource attributes, and numeric
+// fields such as node counts become gauges named "rke2.<field>", with integer
+// or double data points. Counts redacted in minimal mode (-1) are not
+// exported. Volatile fields such as the report ID and timestamp are left out
+// of the attributes, since a collector would otherwise see a new resource
+// with every report.
+func otlpMetrics(data *Data, now time.Time) otlpExportRequest {
+	attrs := []otlpKeyValue{
+		{Key: "service.name", Value: otlpString("rke2-security-responder")},
+		{Key: "appVersion", Value: otlpString(data.AppVersion)},
+		{Key: "schemaVersion", Value: otlpString(data.SchemaVersion)},
+	}
+	for _, key := range sortedKeys(data.ExtraTagInfo) {
+		if volatileFields[key] {
+			continue
+		}
+		attrs = append(attrs, otlpKeyValue{Key: key, Value: otlpString(data.ExtraTagInfo[key])})
+	}
+
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	var metrics []otlpMetric
+	for _, key := range sortedKeys(data.ExtraFieldInfo) {
+		v := data.ExtraFieldInfo[key]
+		point := otlpDataPoint{TimeUnixNano: timestamp}
+		if n, ok := integerField(v); ok {
+			if n < 0 {
+				continue
+			}
+			point.AsInt = strconv.FormatInt(n, 10)
+		} else if f, ok := floatField(v); ok {
+			if f < 0 {
+				continue
+			}
+			point.AsDouble = &f
+		} else {
+			if !volatileFields[key] {
+				attrs = append(attrs, otlpKeyValue{Key: key, Value: otlpValue(v)})
+			}
+			continue
+		}
+		metrics = append(metrics, otlpMetric{
+			Name:  "rke2." + key,
+			Gauge: otlpGauge{DataPoints: []otlpDataPoint{point}},
+		})
+	}
+
+	return otlpExportRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: attrs},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpInstrumentationScope{Name: otlpScope},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// integerField returns v as an int64 if it is an integer field, such as a
+// node count or the responder's allocated memory.
+func integerField(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return unsignedField(uint64(v))
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return unsignedField(v)
+	default:
+		return 0, false
+	}
+}
+
+// unsignedField converts an unsigned field, which no count comes close to
+// overflowing.
+func unsignedField(v uint64) (int64, bool) {
+	if v > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// floatField returns v as a float64 if it is a floating-point field, such
+// as a CPU core total.
+func floatField(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// otlpValue converts a field value to an attribute value. Maps and other
+// structured values are sent as their JSON encoding.
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case []string:
+		values := make([]otlpAnyValue, 0, len(v))
+		for _, s := range v {
+			values = append(values, otlpString(s))
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return otlpString(fmt.Sprint(v))
+		}
+		return otlpString(string(encoded))
+	}
+}
+
+func otlpString(s string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &s}
+}
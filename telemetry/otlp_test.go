@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	data := &Data{
+		SchemaVersion: "1",
+		AppVersion:    "v1.32.2+rke2r1",
+		ExtraTagInfo:  map[string]string{"clusteruuid": "uuid", reportIDKey: "report-id"},
+		ExtraFieldInfo: map[string]interface{}{
+			"timestamp":       "2023-11-14T22:13:20Z",
+			"serverNodeCount": 3,
+			"serverMemory":    int64(8 << 30),
+			"memAllocBytes":   uint64(4 << 20),
+			"totalCpuCores":   float64(12.5),
+			"gpuNodeCount":    -1,
+			"cpuCores":        float64(-1),
+			"cni-plugin":      "canal",
+			"cisHardened":     true,
+			"cni-plugins":     []string{"canal", "multus"},
+			"kubeletVersions": map[string]int{"v1.32.2+rke2r1": 3},
+		},
+	}
+	now := time.Unix(1700000000, 0)
+
+	req := otlpMetrics(data, now)
+	if len(req.ResourceMetrics) != 1 || len(req.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("want one resource with one scope, got %+v", req)
+	}
+
+	attrs := make(map[string]interface{})
+	for _, kv := range req.ResourceMetrics[0].Resource.Attributes {
+		switch {
+		case kv.Value.StringValue != nil:
+			attrs[kv.Key] = *kv.Value.StringValue
+		case kv.Value.BoolValue != nil:
+			attrs[kv.Key] = *kv.Value.BoolValue
+		case kv.Value.ArrayValue != nil:
+			var values []string
+			for _, v := range kv.Value.ArrayValue.Values {
+				values = append(values, *v.StringValue)
+			}
+			attrs[kv.Key] = values
+		}
+	}
+	wantAttrs := map[string]interface{}{
+		"service.name":    "rke2-security-responder",
+		"appVersion":      "v1.32.2+rke2r1",
+		"schemaVersion":   "1",
+		"clusteruuid":     "uuid",
+		"cni-plugin":      "canal",
+		"cisHardened":     true,
+		"cni-plugins":     []string{"canal", "multus"},
+		"kubeletVersions": `{"v1.32.2+rke2r1":3}`,
+	}
+	if !reflect.DeepEqual(attrs, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", attrs, wantAttrs)
+	}
+	// Volatile fields would make every report a new resource.
+	for _, key := range []string{reportIDKey, "timestamp"} {
+		if _, ok := attrs[key]; ok {
+			t.Errorf("attributes include volatile field %s", key)
+		}
+	}
+
+	gauges := make(map[string]string)
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if len(m.Gauge.DataPoints) != 1 {
+			t.Fatalf("%s has %d data points, want 1", m.Name, len(m.Gauge.DataPoints))
+		}
+		if m.Gauge.DataPoints[0].TimeUnixNano != "1700000000000000000" {
+			t.Errorf("%s timeUnixNano = %s", m.Name, m.Gauge.DataPoints[0].TimeUnixNano)
+		}
+		if p := m.Gauge.DataPoints[0]; p.AsDouble != nil {
+			gauges[m.Name] = strconv.FormatFloat(*p.AsDouble, 'g', -1, 64)
+		} else {
+			gauges[m.Name] = p.AsInt
+		}
+	}
+	// Redacted counts are not exported.
+	wantGauges := map[string]string{
+		"rke2.serverNodeCount": "3",
+		"rke2.serverMemory":    "8589934592",
+		"rke2.memAllocBytes":   "4194304",
+		"rke2.totalCpuCores":   "12.5",
+	}
+	if !reflect.DeepEqual(gauges, wantGauges) {
+		t.Errorf("gauges = %v, want %v", gauges, wantGauges)
+	}
+}
+
+func TestSend_OTLP(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("body is not JSON: %v", err)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	data := &Data{
+		AppVersion:     "v1.32.2+rke2r1",
+		ExtraTagInfo:   map[string]string{"clusteruuid": "uuid"},
+		ExtraFieldInfo: map[string]interface{}{"serverNodeCount": 1},
+	}
+	if _, err := Send(context.Background(), data, server.URL, SendOptions{Format: FormatOTLP}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if _, ok := body["resourceMetrics"]; !ok {
+		t.Errorf("request body = %v, want resourceMetrics", body)
+	}
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the Prometheus remote-write v1 messages (prompb).
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+// remoteWriteSample is one time series with a single sample.
+type remoteWriteSample struct {
+	name  string
+	value float64
+}
+
+// remoteWriteSamples maps the numeric fields of data to series named
+// "rke2_<field>". Counts redacted in minimal mode (-1) are not exported.
+func remoteWriteSamples(data *Data) []remoteWriteSample {
+	var samples []remoteWriteSample
+	for _, key := range sortedKeys(data.ExtraFieldInfo) {
+		value, ok := sampleValueOf(data.ExtraFieldInfo[key])
+		if !ok || value < 0 {
+			continue
+		}
+		samples = append(samples, remoteWriteSample{name: "rke2_" + metricName(key), value: value})
+	}
+	return samples
+}
+
+// sampleValueOf returns v as a sample value if it is an integer or
+// floating-point field.
+func sampleValueOf(v interface{}) (float64, bool) {
+	if n, ok := integerField(v); ok {
+		return float64(n), true
+	}
+	return floatField(v)
+}
+
+// marshalRemoteWrite encodes data as a snappy-compressed remote-write
+// WriteRequest. Each series is labelled with the cluster UUID.
+func marshalRemoteWrite(data *Data, now time.Time) []byte {
+	labels := map[string]string{"cluster_uuid": data.ExtraTagInfo["clusteruuid"]}
+	timestamp := now.UnixMilli()
+
+	var req []byte
+	for _, sample := range remoteWriteSamples(data) {
+		series := appendTimeSeries(nil, sample, labels, timestamp)
+		req = protowire.AppendTag(req, writeRequestTimeseries, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+	return snappy.Encode(nil, req)
+}
+
+// appendTimeSeries appends a TimeSeries message. Receivers require labels
+// sorted by name; "__name__" sorts first.
+func appendTimeSeries(b []byte, sample remoteWriteSample, labels map[string]string, timestamp int64) []byte {
+	b = appendLabel(b, "__name__", sample.name)
+	for _, name := range sortedKeys(labels) {
+		b = appendLabel(b, name, labels[name])
+	}
+
+	var s []byte
+	s = protowire.AppendTag(s, sampleValue, protowire.Fixed64Type)
+	s = protowire.AppendFixed64(s, math.Float64bits(sample.value))
+	s = protowire.AppendTag(s, sampleTimestamp, protowire.VarintType)
+	s = protowire.AppendVarint(s, uint64(timestamp))
+	b = protowire.AppendTag(b, timeSeriesSamples, protowire.BytesType)
+	return protowire.AppendBytes(b, s)
+}
+
+func appendLabel(b []byte, name, value string) []byte {
+	var l []byte
+	l = protowire.AppendTag(l, labelName, protowire.BytesType)
+	l = protowire.AppendString(l, name)
+	l = protowire.AppendTag(l, labelValue, protowire.BytesType)
+	l = protowire.AppendString(l, value)
+	b = protowire.AppendTag(b, timeSeriesLabels, protowire.BytesType)
+	return protowire.AppendBytes(b, l)
+}
+
+// metricName replaces characters that are not valid in a Prometheus metric
+// name, such as the hyphens in "gpu-operator", with underscores.
+func metricName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+}
@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedSeries is a remote-write TimeSeries with its single sample.
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeRemoteWrite parses a snappy-compressed WriteRequest body.
+func decodeRemoteWrite(t *testing.T, body []byte) []decodedSeries {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy decode: %v", err)
+	}
+
+	// fields calls fn for each length-delimited or scalar field in b.
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("bad tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			m := protowire.ConsumeFieldValue(num, typ, b)
+			if m < 0 {
+				t.Fatalf("bad field %d: %v", num, protowire.ParseError(m))
+			}
+			v := b[:m]
+			if typ == protowire.BytesType {
+				v, _ = protowire.ConsumeBytes(v)
+			}
+			fn(num, typ, v)
+			b = b[m:]
+		}
+	}
+
+	var series []decodedSeries
+	fields(raw, func(_ protowire.Number, _ protowire.Type, ts []byte) {
+		s := decodedSeries{labels: map[string]string{}}
+		var names []string
+		fields(ts, func(num protowire.Number, _ protowire.Type, v []byte) {
+			switch num {
+			case timeSeriesLabels:
+				var name, value string
+				fields(v, func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == labelName {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				names = append(names, name)
+				s.labels[name] = value
+			case timeSeriesSamples:
+				fields(v, func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == sampleValue {
+						bits, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(ts)
+					}
+				})
+			}
+		})
+		for i := 1; i < len(names); i++ {
+			if names[i-1] >= names[i] {
+				t.Errorf("labels not sorted: %v", names)
+			}
+		}
+		series = append(series, s)
+	})
+	return series
+}
+
+func TestMarshalRemoteWrite(t *testing.T) {
+	data := &Data{
+		AppVersion:   "v1.32.2+rke2r1",
+		ExtraTagInfo: map[string]string{"clusteruuid": "uuid"},
+		ExtraFieldInfo: map[string]interface{}{
+			"serverNodeCount":      3,
+			"serverMemory":         int64(8 << 30),
+			"gpuNodeCount":         -1,
+			"collectionDurationMs": int64(412),
+			"memAllocBytes":        uint64(4 << 20),
+			"totalCpuCores":        float64(12.5),
+			"allocatableCpuCores":  float64(-1),
+			"cni-plugin":           "canal",
+			"cisHardened":          true,
+		},
+	}
+	now := time.UnixMilli(1700000000123)
+
+	got := make(map[string]float64)
+	for _, s := range decodeRemoteWrite(t, marshalRemoteWrite(data, now)) {
+		if s.labels["cluster_uuid"] != "uuid" || len(s.labels) != 2 {
+			t.Errorf("labels = %v, want __name__ and cluster_uuid", s.labels)
+		}
+		if s.timestamp != 1700000000123 {
+			t.Errorf("%s timestamp = %d", s.labels["__name__"], s.timestamp)
+		}
+		got[s.labels["__name__"]] = s.value
+	}
+	// Redacted counts and non-numeric fields are not exported.
+	want := map[string]float64{
+		"rke2_serverNodeCount":      3,
+		"rke2_serverMemory":         8 << 30,
+		"rke2_collectionDurationMs": 412,
+		"rke2_memAllocBytes":        4 << 20,
+		"rke2_totalCpuCores":        12.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"serverNodeCount", "serverNodeCount"},
+		{"gpu-operator", "gpu_operator"},
+		{"rancher.version", "rancher_version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := metricName(tt.key); got != tt.want {
+				t.Errorf("metricName(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend_RemoteWrite(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	data := &Data{
+		ExtraTagInfo:   map[string]string{"clusteruuid": "uuid"},
+		ExtraFieldInfo: map[string]interface{}{"serverNodeCount": 1},
+	}
+	// Compress is ignored: remote-write bodies are always snappy-compressed.
+	resp, err := Send(context.Background(), data, server.URL, SendOptions{Format: FormatRemoteWrite, Compress: true})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp != nil {
+		t.Errorf("Send() response = %+v, want nil", resp)
+	}
+
+	wantHeaders := map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+	for name, want := range wantHeaders {
+		if got := headers.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if series := decodeRemoteWrite(t, body); len(series) != 1 || series[0].labels["__name__"] != "rke2_serverNodeCount" {
+		t.Errorf("series = %+v, want rke2_serverNodeCount", series)
+	}
+}
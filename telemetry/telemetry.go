@@ -2,35 +2,216 @@ package telemetry
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 )
 
 const (
 	DefaultEndpoint = "https://security-responder.rke2.io/v1/check"
 	defaultTimeout  = 30 * time.Second
-	maxRetries      = 3
-	retryDelay      = 2 * time.Second
+	// DefaultMaxRetries is the number of retries after the first attempt.
+	DefaultMaxRetries    = 3
+	DefaultRetryDelay    = 2 * time.Second
+	DefaultMaxRetryDelay = 30 * time.Second
+	defaultUserAgent     = "rke2-security-responder"
+	// reportIDKey is the ExtraTagInfo key of the per-collection report ID,
+	// also sent as the X-Idempotency-Key header.
+	reportIDKey = "reportId"
+	// clusterUUIDPlaceholder in an endpoint is replaced by the cluster UUID.
+	clusterUUIDPlaceholder = "{clusterUUID}"
+	// SchemaVersion identifies the payload layout to receivers. Bump it when
+	// fields are renamed, removed, or change type.
+	SchemaVersion = "1"
+	// maxRetryAfter caps server-requested delays so a hostile value cannot hang the pod.
+	maxRetryAfter = 5 * time.Minute
 )
 
+// SendOptions controls how Send delivers the payload.
+type SendOptions struct {
+	// Client performs the requests. A nil Client uses a plain client with the
+	// default timeout; use NewClient to honor proxy settings.
+	Client *http.Client
+	// MaxRetries is the number of retries after the first attempt; 0 sends once.
+	MaxRetries int
+	// RetryDelay is the base delay, doubled after each attempt and capped at
+	// MaxRetryDelay (no cap when zero). The actual sleep is jittered.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Compress gzips the body and sets Content-Encoding: gzip.
+	Compress bool
+	// AuthToken is sent as a bearer token. It must never be logged.
+	AuthToken string
+	// HMACKey, when set, signs the request body with HMAC-SHA256, sent as
+	// "X-Signature: sha256=<hex>". It must never be logged.
+	HMACKey string
+	// Format is FormatJSON (the default when empty), FormatOTLP,
+	// FormatRemoteWrite, or FormatGRPC.
+	Format string
+	// Method is http.MethodPost (the default when empty) or http.MethodPut.
+	Method string
+	// UserAgent identifies the responder build, e.g.
+	// "rke2-security-responder/v1.0.0". Empty sends defaultUserAgent.
+	UserAgent string
+	// Streaks records each endpoint's consecutive failures across SendAll
+	// calls in periodic mode; nil does not track them.
+	Streaks *FailureStreaks
+	// Breaker skips endpoints that keep failing; nil sends to every endpoint.
+	Breaker *CircuitBreaker
+}
+
+// DefaultSendOptions returns the options used when nothing is configured.
+func DefaultSendOptions() SendOptions {
+	return SendOptions{
+		MaxRetries:    DefaultMaxRetries,
+		RetryDelay:    DefaultRetryDelay,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+	}
+}
+
 type Data struct {
+	// SchemaVersion is SchemaVersion unless overridden for testing.
+	SchemaVersion  string                 `json:"schemaVersion"`
 	AppVersion     string                 `json:"appVersion"`
 	ExtraTagInfo   map[string]string      `json:"extraTagInfo"`
 	ExtraFieldInfo map[string]interface{} `json:"extraFieldInfo"`
 }
 
+// Filter keeps only the ExtraTagInfo and ExtraFieldInfo keys listed in
+// fields, plus reportId, which receivers need to deduplicate retries. Listed
+// keys that are not in the payload are ignored with a warning.
+func (d *Data) Filter(fields []string) {
+	allowed := map[string]bool{reportIDKey: true}
+	for _, field := range fields {
+		_, isTag := d.ExtraTagInfo[field]
+		_, isField := d.ExtraFieldInfo[field]
+		if !isTag && !isField {
+			logrus.WithField("field", field).Warn("allowlisted field not in payload, ignoring")
+		}
+		allowed[field] = true
+	}
+	for key := range d.ExtraTagInfo {
+		if !allowed[key] {
+			delete(d.ExtraTagInfo, key)
+		}
+	}
+	for key := range d.ExtraFieldInfo {
+		if !allowed[key] {
+			delete(d.ExtraFieldInfo, key)
+		}
+	}
+}
+
+// RenameFields renames ExtraTagInfo and ExtraFieldInfo keys from the keys
+// of names to their values, e.g. to match a receiver's snake_case schema.
+// Keys not in names are unchanged, as are nested keys. reportId is never
+// renamed, since Send reads it for the idempotency key.
+func (d *Data) RenameFields(names map[string]string) {
+	renameKeys(d.ExtraTagInfo, names)
+	renameKeys(d.ExtraFieldInfo, names)
+}
+
+// renameKeys renames the keys of m in place. A renamed key replaces an
+// existing key of the same name, with a warning.
+func renameKeys[V any](m map[string]V, names map[string]string) {
+	renamed := make(map[string]V)
+	for key, value := range m {
+		if name, ok := names[key]; ok && name != key && key != reportIDKey {
+			renamed[name] = value
+			delete(m, key)
+		}
+	}
+	for key, value := range renamed {
+		if _, ok := m[key]; ok {
+			logrus.WithField("field", key).Warn("renamed field replaces an existing field")
+		}
+		m[key] = value
+	}
+}
+
+// volatileFields change with every collection even when the cluster does
+// not, so Digest leaves them out and OTLP does not make them resource
+// attributes.
+var volatileFields = map[string]bool{
+	reportIDKey:              true,
+	"timestamp":              true,
+	"collectionDurationMs":   true,
+	"clusterAge":             true,
+	"oldestNodeAge":          true,
+	"newestNodeAge":          true,
+	"responderMemAllocBytes": true,
+	"responderGoroutines":    true,
+}
+
+// Digest returns the hex SHA-256 of the payload without its volatile fields,
+// so that two reports of an unchanged cluster have the same digest. Map keys
+// are marshaled in sorted order, which keeps it stable.
+func (d *Data) Digest() (string, error) {
+	stable := Data{
+		SchemaVersion:  d.SchemaVersion,
+		AppVersion:     d.AppVersion,
+		ExtraTagInfo:   make(map[string]string, len(d.ExtraTagInfo)),
+		ExtraFieldInfo: make(map[string]interface{}, len(d.ExtraFieldInfo)),
+	}
+	for key, value := range d.ExtraTagInfo {
+		if !volatileFields[key] {
+			stable.ExtraTagInfo[key] = value
+		}
+	}
+	for key, value := range d.ExtraFieldInfo {
+		if !volatileFields[key] {
+			stable.ExtraFieldInfo[key] = value
+		}
+	}
+	b, err := json.Marshal(stable)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AddTags sets the given ExtraTagInfo entries. Operator-supplied tags win
+// over collected ones; each overwritten tag is logged with a warning.
+func (d *Data) AddTags(tags map[string]string) {
+	for key, value := range tags {
+		if old, ok := d.ExtraTagInfo[key]; ok && old != value {
+			logrus.WithField("tag", key).Warn("static tag overrides collected tag")
+		}
+		d.ExtraTagInfo[key] = value
+	}
+}
+
 type Response struct {
 	Versions                 []Version `json:"versions"`
 	RequestIntervalInMinutes int       `json:"requestIntervalInMinutes"`
@@ -44,201 +225,844 @@ type Version struct {
 	ExtraInfo            map[string]string `json:"extraInfo,omitempty"`
 }
 
-func Collect(ctx context.Context, clientset kubernetes.Interface, mode string) (*Data, error) {
+// CollectOptions controls what Collect gathers.
+type CollectOptions struct {
+	// Mode is "recommended" or "minimal".
+	Mode string
+	// CNINamespaces are searched for the CNI when kube-system has no match.
+	// Empty searches all namespaces.
+	CNINamespaces []string
+	// NodePageSize is the page size for listing nodes (default 100).
+	NodePageSize int64
+	// NodeSelector is a label selector limiting which nodes are summarized.
+	// Empty summarizes all nodes.
+	NodeSelector string
+	// HashNodeNames reports not-ready nodes in "notReadyNodes" by the
+	// truncated hex SHA-256 of their names.
+	HashNodeNames bool
+	// HashClusterUUID replaces the cluster UUID with the hex SHA-256 of
+	// ClusterUUIDSalt followed by the UUID. The salt must never be logged.
+	HashClusterUUID bool
+	ClusterUUIDSalt string
+	// Extensions lists CustomResourceDefinitions; nil skips CRD collection.
+	Extensions apiextensionsclientset.Interface
+	// Metadata lists object metadata only, so that counting pods and
+	// Secrets never downloads their specs or data; nil skips the pod and
+	// private registry Secret counts.
+	Metadata metadata.Interface
+	// VersionCache reuses the server version across collections; nil
+	// fetches it every time.
+	VersionCache *VersionCache
+	// BestEffort makes version, cluster UUID, node, and kube-system workload
+	// failures non-fatal. The failed steps are listed in "collectionErrors"
+	// and the rest of the payload is still returned.
+	BestEffort bool
+	// TopNamespaces is how many of the namespaces with the most pods are
+	// reported, by hashed name, in "topNamespaces"; 0 reports none.
+	TopNamespaces int
+	// IncludeRuntimeStats adds the responder's own Go version, heap
+	// allocation, and goroutine count, sampled once collection finishes.
+	IncludeRuntimeStats bool
+	// Detectors are the add-on detectors to run; nil runs DefaultDetectors.
+	Detectors []Detector
+	// DisableDetectors names detectors to skip.
+	DisableDetectors []string
+}
+
+func (o CollectOptions) detectors() []Detector {
+	if o.Detectors != nil {
+		return o.Detectors
+	}
+	return DefaultDetectors()
+}
+
+func (o CollectOptions) nodePageSize() int64 {
+	if o.NodePageSize > 0 {
+		return o.NodePageSize
+	}
+	return defaultNodePageSize
+}
+
+func Collect(ctx context.Context, clientset kubernetes.Interface, opts CollectOptions) (*Data, error) {
+	mode := opts.Mode
 	data := &Data{
+		SchemaVersion:  SchemaVersion,
 		ExtraTagInfo:   make(map[string]string),
 		ExtraFieldInfo: make(map[string]interface{}),
 	}
+	data.ExtraTagInfo[reportIDKey] = uuid.NewString()
 	data.ExtraFieldInfo["mode"] = mode
 	isMinimal := mode == "minimal"
+	start := time.Now()
+	data.ExtraFieldInfo["timestamp"] = start.UTC().Format(time.RFC3339)
 
-	logrus.Debug("collecting server version")
-	versionInfo, err := clientset.Discovery().ServerVersion()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get server version: %w", err)
+	// Steps run concurrently. Version, namespace, node, and kube-system
+	// workload failures are fatal and cancel the remaining steps, unless
+	// opts.BestEffort is set; add-on detection degrades to "unknown" instead.
+	c := newCollection(ctx, data)
+	c.bestEffort = opts.BestEffort
+
+	// The server version is fetched once and shared by the steps that need it.
+	serverInfo := sync.OnceValues(func() (*version.Info, error) {
+		return opts.VersionCache.get(c.ctx, clientset)
+	})
+
+	c.step("server version", func(ctx context.Context) error {
+		versionInfo, err := serverInfo()
+		if err != nil {
+			return fmt.Errorf("failed to get server version: %w", err)
+		}
+		c.update(func(data *Data) {
+			data.AppVersion = versionInfo.GitVersion
+			data.ExtraTagInfo["kubernetesVersion"] = versionInfo.GitVersion
+			major, minor, semver := kubernetesVersionTags(versionInfo)
+			for key, value := range map[string]string{"k8sMajor": major, "k8sMinor": minor, "k8sSemver": semver} {
+				if value != "" {
+					data.ExtraTagInfo[key] = value
+				}
+			}
+		})
+		logrus.WithField("version", versionInfo.GitVersion).Debug("collected version")
+		return nil
+	})
+
+	c.step("cluster UUID", func(ctx context.Context) error {
+		namespace, err := clientset.CoreV1().Namespaces().Get(ctx, "kube-system", metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get kube-system namespace: %w", err)
+		}
+		uuid := string(namespace.UID)
+		if opts.HashClusterUUID {
+			uuid = hashClusterUUID(uuid, opts.ClusterUUIDSalt)
+		}
+		c.update(func(data *Data) {
+			data.ExtraTagInfo["clusteruuid"] = uuid
+			// kube-system is created with the cluster, so its age is the cluster's.
+			if created := namespace.CreationTimestamp.Time; isMinimal {
+				data.ExtraFieldInfo["clusterAge"] = int64(-1)
+			} else if !created.IsZero() {
+				data.ExtraFieldInfo["clusterAge"] = ageSeconds(start, created)
+			}
+		})
+		logrus.WithFields(logrus.Fields{"uuid": uuid, "hashed": opts.HashClusterUUID}).Debug("collected cluster UUID")
+		return nil
+	})
+
+	c.step("nodes", func(ctx context.Context) error {
+		nodes := newNodeSummary()
+		nodes.hashNodeNames = opts.HashNodeNames
+		err := paginateN(opts.nodePageSize(), func(listOpts metav1.ListOptions) (string, error) {
+			listOpts.LabelSelector = opts.NodeSelector
+			list, err := clientset.CoreV1().Nodes().List(ctx, listOpts)
+			if err != nil {
+				return "", err
+			}
+			for i := range list.Items {
+				nodes.add(&list.Items[i])
+			}
+			return list.Continue, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		c.update(func(data *Data) {
+			nodes.report(data, isMinimal)
+			if opts.NodeSelector != "" {
+				// Receivers must not read selected counts as cluster totals.
+				data.ExtraFieldInfo["nodeSelectorApplied"] = true
+			}
+		})
+		return nil
+	})
+
+	if opts.Metadata != nil {
+		c.step("pods", func(ctx context.Context) error {
+			pods, err := countPods(ctx, opts.Metadata)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to count pods")
+				return nil
+			}
+			c.update(func(data *Data) {
+				if isMinimal {
+					data.ExtraFieldInfo["podCount"] = -1
+					data.ExtraFieldInfo["runningPodCount"] = -1
+				} else {
+					data.ExtraFieldInfo["podCount"] = pods.total
+					data.ExtraFieldInfo["runningPodCount"] = pods.running
+				}
+				if opts.TopNamespaces > 0 {
+					top := []namespacePods{}
+					if !isMinimal {
+						top = topNamespaces(pods.perNamespace, opts.TopNamespaces)
+					}
+					data.ExtraFieldInfo["topNamespaces"] = top
+				}
+			})
+			logrus.WithFields(logrus.Fields{"pods": pods.total, "running": pods.running, "namespaces": len(pods.perNamespace)}).Debug("counted pods")
+			return nil
+		})
 	}
-	data.AppVersion = versionInfo.GitVersion
-	data.ExtraTagInfo["kubernetesVersion"] = versionInfo.GitVersion
-	logrus.WithField("version", versionInfo.GitVersion).Debug("collected version")
 
-	logrus.Debug("collecting cluster UUID from kube-system namespace")
-	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, "kube-system", metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kube-system namespace: %w", err)
+	c.step("namespaces", func(ctx context.Context) error {
+		namespaces, err := summarizeNamespaces(ctx, clientset)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to list namespaces")
+			return nil
+		}
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["namespaceCount"] = -1
+				data.ExtraFieldInfo["namespaceDigest"] = ""
+			} else {
+				data.ExtraFieldInfo["namespaceCount"] = namespaces.count
+				data.ExtraFieldInfo["namespaceDigest"] = namespaces.digest
+			}
+			data.ExtraFieldInfo["podSecurity"] = countsForMode(namespaces.podSecurity, isMinimal)
+		})
+		logrus.WithFields(logrus.Fields{
+			"namespaces":  namespaces.count,
+			"digest":      namespaces.digest,
+			"podSecurity": namespaces.podSecurity,
+		}).Debug("collected namespaces")
+		return nil
+	})
+
+	c.step("network policies", func(ctx context.Context) error {
+		policies, namespaces, err := countNetworkPolicies(ctx, clientset)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to count network policies")
+			return nil
+		}
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["networkPolicyCount"] = -1
+				data.ExtraFieldInfo["namespacesWithNetworkPolicy"] = -1
+			} else {
+				data.ExtraFieldInfo["networkPolicyCount"] = policies
+				data.ExtraFieldInfo["namespacesWithNetworkPolicy"] = namespaces
+			}
+		})
+		logrus.WithFields(logrus.Fields{"policies": policies, "namespaces": namespaces}).Debug("counted network policies")
+		return nil
+	})
+
+	c.step("kube-system workloads", func(ctx context.Context) error {
+		kubeSystemDS, err := clientset.AppsV1().DaemonSets("kube-system").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list kube-system daemonsets: %w", err)
+		}
+		kubeSystemDeploy, err := clientset.AppsV1().Deployments("kube-system").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list kube-system deployments: %w", err)
+		}
+
+		c.step("CNI", func(ctx context.Context) error {
+			cniPlugin, cniVersion, cniPlugins := detectCNIPlugin(kubeSystemDS.Items)
+			if cniPlugin == "unknown" {
+				cniPlugin, cniVersion, cniPlugins = detectCNIPluginOutsideKubeSystem(ctx, clientset, opts.CNINamespaces)
+			}
+			c.update(func(data *Data) {
+				data.ExtraFieldInfo["cni-plugin"] = cniPlugin
+				data.ExtraFieldInfo["cni-plugins"] = cniPlugins
+				if cniVersion != "" {
+					data.ExtraFieldInfo["cni-version"] = cniVersion
+				}
+			})
+			logrus.WithFields(logrus.Fields{"plugin": cniPlugin, "version": cniVersion, "plugins": cniPlugins}).Debug("detected CNI")
+			return nil
+		})
+
+		ingressController, ingressImage := detectIngressController(kubeSystemDeploy.Items, kubeSystemDS.Items)
+		// ingress-version keeps its original parsing for existing receivers;
+		// ingress-controller-version reports digest-pinned images as unknown.
+		ingressVersion := extractImageVersion(ingressImage)
+		controllerVersion := imageTag(ingressImage)
+		if controllerVersion == "" {
+			controllerVersion = "unknown"
+		}
+		c.update(func(data *Data) {
+			data.ExtraFieldInfo["ingress-controller"] = ingressController
+			if ingressVersion != "" {
+				data.ExtraFieldInfo["ingress-version"] = ingressVersion
+			}
+			if ingressController != "none" {
+				data.ExtraFieldInfo["ingress-controller-version"] = controllerVersion
+			}
+		})
+		logrus.WithFields(logrus.Fields{"controller": ingressController, "version": controllerVersion}).Debug("detected ingress")
+		return nil
+	})
+
+	c.step("GPU operator", func(ctx context.Context) error {
+		gpuOperator, gpuOperatorVersion := detectGPUOperator(ctx, clientset)
+		if gpuOperator != "none" {
+			c.update(func(data *Data) {
+				data.ExtraFieldInfo["gpu-operator"] = gpuOperator
+				if gpuOperatorVersion != "" {
+					data.ExtraFieldInfo["gpu-operator-version"] = gpuOperatorVersion
+				}
+			})
+		}
+		logrus.WithFields(logrus.Fields{"operator": gpuOperator, "version": gpuOperatorVersion}).Debug("detected GPU operator")
+		return nil
+	})
+
+	c.step("Rancher Manager", func(ctx context.Context) error {
+		rancherManaged, rancherVersion, rancherInstallUUID, err := detectRancherManager(ctx, clientset)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to detect Rancher Manager")
+			c.update(func(data *Data) {
+				data.ExtraFieldInfo["rancherManaged"] = "unknown"
+			})
+			return nil
+		}
+		c.update(func(data *Data) {
+			// rancher-managed predates rancherManaged and is kept for
+			// existing receivers.
+			data.ExtraFieldInfo["rancherManaged"] = rancherManaged
+			data.ExtraFieldInfo["rancher-managed"] = rancherManaged
+			if isMinimal {
+				data.ExtraFieldInfo["rancher-version"] = ""
+				data.ExtraFieldInfo["rancher-install-uuid"] = ""
+				return
+			}
+			if rancherVersion != "" {
+				data.ExtraFieldInfo["rancher-version"] = rancherVersion
+			}
+			if rancherInstallUUID != "" {
+				data.ExtraFieldInfo["rancher-install-uuid"] = rancherInstallUUID
+			}
+		})
+		logrus.WithFields(logrus.Fields{"managed": rancherManaged, "version": rancherVersion, "installUUID": rancherInstallUUID}).Debug("detected Rancher")
+		return nil
+	})
+
+	c.step("admission webhooks", func(ctx context.Context) error {
+		validating, mutating, err := countWebhookConfigurations(ctx, clientset)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to count admission webhooks")
+			return nil
+		}
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["validatingWebhooks"] = -1
+				data.ExtraFieldInfo["mutatingWebhooks"] = -1
+			} else {
+				data.ExtraFieldInfo["validatingWebhooks"] = validating
+				data.ExtraFieldInfo["mutatingWebhooks"] = mutating
+			}
+		})
+		logrus.WithFields(logrus.Fields{"validating": validating, "mutating": mutating}).Debug("counted admission webhooks")
+		return nil
+	})
+
+	if opts.Extensions != nil {
+		c.step("CRDs", func(ctx context.Context) error {
+			total, groups, err := countCRDs(ctx, opts.Extensions)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to count CRDs")
+				return nil
+			}
+			c.update(func(data *Data) {
+				if isMinimal {
+					data.ExtraFieldInfo["crdCount"] = -1
+				} else {
+					data.ExtraFieldInfo["crdCount"] = total
+				}
+				data.ExtraFieldInfo["crdGroups"] = countsForMode(groups, isMinimal)
+			})
+			logrus.WithFields(logrus.Fields{"crds": total, "groups": len(groups)}).Debug("counted CRDs")
+			return nil
+		})
 	}
-	data.ExtraTagInfo["clusteruuid"] = string(namespace.UID)
-	logrus.WithField("uuid", namespace.UID).Debug("collected cluster UUID")
 
-	logrus.Debug("collecting node information")
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
-	}
-
-	var serverNodeCount, agentNodeCount, gpuNodeCount int
-	var serverCPU, agentCPU, serverMemory, agentMemory int64
-	var operatingSystem, osImage, kernelVersion, arch, selinuxInfo, gpuVendor string
-
-	gpuResources := []corev1.ResourceName{"nvidia.com/gpu", "amd.com/gpu", "intel.com/gpu"}
-	gpuVendorMap := map[corev1.ResourceName]string{
-		"nvidia.com/gpu": "nvidia",
-		"amd.com/gpu":    "amd",
-		"intel.com/gpu":  "intel",
-	}
-
-	for _, node := range nodes.Items {
-		cpu := node.Status.Allocatable.Cpu().MilliValue()
-		mem := node.Status.Allocatable.Memory().Value()
-		if isControlPlaneNode(&node) {
-			serverNodeCount++
-			serverCPU += cpu
-			serverMemory += mem
-		} else {
-			agentNodeCount++
-			agentCPU += cpu
-			agentMemory += mem
-		}
-		if osImage == "" {
-			operatingSystem = node.Status.NodeInfo.OperatingSystem
-			osImage = node.Status.NodeInfo.OSImage
-			kernelVersion = node.Status.NodeInfo.KernelVersion
-			arch = node.Status.NodeInfo.Architecture
-		}
-		if selinuxInfo == "" {
-			selinuxInfo = getSELinuxStatus(&node)
-		}
-		for _, res := range gpuResources {
-			if qty, ok := node.Status.Allocatable[res]; ok {
-				if count, _ := qty.AsInt64(); count > 0 {
-					gpuNodeCount++
-					if gpuVendor == "" {
-						gpuVendor = gpuVendorMap[res]
-					}
-					break
+	c.step("exposed services", func(ctx context.Context) error {
+		loadBalancers, nodePorts, err := countExposedServices(ctx, clientset)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to count exposed services")
+			return nil
+		}
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["loadBalancerServices"] = -1
+				data.ExtraFieldInfo["nodePortServices"] = -1
+			} else {
+				data.ExtraFieldInfo["loadBalancerServices"] = loadBalancers
+				data.ExtraFieldInfo["nodePortServices"] = nodePorts
+			}
+		})
+		logrus.WithFields(logrus.Fields{"loadBalancers": loadBalancers, "nodePorts": nodePorts}).Debug("counted exposed services")
+		return nil
+	})
+
+	if opts.Metadata != nil {
+		c.step("private registry secrets", func(ctx context.Context) error {
+			count, err := countPrivateRegistrySecrets(ctx, opts.Metadata)
+			if apierrors.IsForbidden(err) {
+				// The default install grants no access to Secrets.
+				logrus.WithError(err).Debug("not permitted to count private registry secrets")
+				c.update(func(data *Data) {
+					data.ExtraFieldInfo["privateRegistrySecretCount"] = "unknown"
+				})
+				return nil
+			}
+			if err != nil {
+				logrus.WithError(err).Warn("failed to count private registry secrets")
+				return nil
+			}
+			c.update(func(data *Data) {
+				if isMinimal {
+					data.ExtraFieldInfo["privateRegistrySecretCount"] = -1
+				} else {
+					data.ExtraFieldInfo["privateRegistrySecretCount"] = count
 				}
+			})
+			logrus.WithField("count", count).Debug("counted private registry secrets")
+			return nil
+		})
+	}
+
+	c.step("CIS profile", func(ctx context.Context) error {
+		hardened, profile := detectCISProfile(ctx, clientset)
+		c.update(func(data *Data) {
+			data.ExtraFieldInfo["cisHardened"] = hardened
+			if profile != "" {
+				data.ExtraFieldInfo["cisProfile"] = profile
 			}
+		})
+		logrus.WithFields(logrus.Fields{"hardened": hardened, "profile": profile}).Debug("detected CIS profile")
+		return nil
+	})
+
+	c.step("service CIDR", func(ctx context.Context) error {
+		serviceCIDR := detectServiceCIDR(ctx, clientset)
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["serviceCIDR"] = ""
+			} else {
+				data.ExtraFieldInfo["serviceCIDR"] = serviceCIDR
+			}
+		})
+		logrus.WithField("serviceCIDR", serviceCIDR).Debug("detected service CIDR")
+		return nil
+	})
+
+	c.step("API server endpoints", func(ctx context.Context) error {
+		versionInfo, err := serverInfo()
+		if err != nil {
+			// The server version step reports this failure.
+			return nil
+		}
+		count, err := countAPIServerEndpoints(ctx, clientset, servesEndpointSlices(versionInfo))
+		if err != nil {
+			logrus.WithError(err).Warn("failed to count API server endpoints")
+			return nil
 		}
+		c.update(func(data *Data) {
+			if isMinimal {
+				data.ExtraFieldInfo["apiServerEndpointCount"] = -1
+			} else {
+				data.ExtraFieldInfo["apiServerEndpointCount"] = count
+			}
+		})
+		logrus.WithField("count", count).Debug("counted API server endpoints")
+		return nil
+	})
+
+	disabled := make(map[string]bool, len(opts.DisableDetectors))
+	for _, name := range opts.DisableDetectors {
+		disabled[name] = true
+	}
+	for _, d := range opts.detectors() {
+		if disabled[d.Name()] {
+			logrus.WithField("detector", d.Name()).Debug("detector disabled")
+			continue
+		}
+		c.step(d.Name(), func(ctx context.Context) error {
+			entries, err := d.Detect(ctx, clientset)
+			if err != nil {
+				logrus.WithField("detector", d.Name()).WithError(err).Warn("detector failed")
+				return nil
+			}
+			c.update(func(data *Data) {
+				for key, value := range entries {
+					data.ExtraFieldInfo[key] = value
+				}
+			})
+			logrus.WithFields(logrus.Fields(entries)).WithField("detector", d.Name()).Debug("detected")
+			return nil
+		})
 	}
 
-	if isMinimal {
-		data.ExtraFieldInfo["serverNodeCount"] = -1
-		data.ExtraFieldInfo["agentNodeCount"] = -1
-		data.ExtraFieldInfo["gpuNodeCount"] = -1
-		data.ExtraFieldInfo["serverCPU"] = int64(-1)
-		data.ExtraFieldInfo["agentCPU"] = int64(-1)
-		data.ExtraFieldInfo["serverMemory"] = int64(-1)
-		data.ExtraFieldInfo["agentMemory"] = int64(-1)
-	} else {
-		data.ExtraFieldInfo["serverNodeCount"] = serverNodeCount
-		data.ExtraFieldInfo["agentNodeCount"] = agentNodeCount
-		data.ExtraFieldInfo["serverCPU"] = serverCPU
-		data.ExtraFieldInfo["agentCPU"] = agentCPU
-		data.ExtraFieldInfo["serverMemory"] = serverMemory
-		data.ExtraFieldInfo["agentMemory"] = agentMemory
-		data.ExtraFieldInfo["gpuNodeCount"] = gpuNodeCount
-	}
-	data.ExtraFieldInfo["operating-system"] = operatingSystem
-	data.ExtraFieldInfo["os"] = osImage
-	data.ExtraFieldInfo["kernel"] = kernelVersion
-	data.ExtraFieldInfo["arch"] = arch
-	data.ExtraFieldInfo["selinux"] = selinuxInfo
-	if gpuVendor != "" {
-		data.ExtraFieldInfo["gpu-vendor"] = gpuVendor
-	}
-	logrus.WithFields(logrus.Fields{
-		"server":       serverNodeCount,
-		"agent":        agentNodeCount,
-		"serverCPU":    serverCPU,
-		"agentCPU":     agentCPU,
-		"serverMemory": serverMemory,
-		"agentMemory":  agentMemory,
-		"gpuNodeCount": gpuNodeCount,
-	}).Debug("collected nodes")
-
-	logrus.Debug("collecting kube-system workloads")
-	kubeSystemDS, err := clientset.AppsV1().DaemonSets("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list kube-system daemonsets: %w", err)
+	if err := c.wait(); err != nil {
+		return nil, err
 	}
-	kubeSystemDeploy, err := clientset.AppsV1().Deployments("kube-system").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list kube-system deployments: %w", err)
+	if len(c.failed) > 0 {
+		sort.Strings(c.failed)
+		data.ExtraFieldInfo["collectionErrors"] = c.failed
+	}
+	data.ExtraFieldInfo["collectionDurationMs"] = time.Since(start).Milliseconds()
+	if opts.IncludeRuntimeStats {
+		addRuntimeStats(data)
 	}
+	recordNodeCounts(data)
+	return data, nil
+}
 
-	logrus.Debug("detecting CNI plugin")
-	cniPlugin, cniVersion := detectCNIPlugin(kubeSystemDS.Items)
-	data.ExtraFieldInfo["cni-plugin"] = cniPlugin
-	if cniVersion != "" {
-		data.ExtraFieldInfo["cni-version"] = cniVersion
+// addRuntimeStats reports the responder's own resource usage. It describes
+// the responder rather than the cluster, so minimal mode does not redact it.
+func addRuntimeStats(data *Data) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	data.ExtraFieldInfo["responderGoVersion"] = runtime.Version()
+	data.ExtraFieldInfo["responderMemAllocBytes"] = mem.Alloc
+	data.ExtraFieldInfo["responderGoroutines"] = runtime.NumGoroutine()
+}
+
+// collection runs collection steps concurrently and serializes their writes
+// to the payload.
+type collection struct {
+	parent context.Context
+	group  *errgroup.Group
+	ctx    context.Context
+
+	// bestEffort records failed steps in failed instead of failing the
+	// collection.
+	bestEffort bool
+
+	mu     sync.Mutex
+	data   *Data
+	failed []string
+}
+
+func newCollection(ctx context.Context, data *Data) *collection {
+	group, groupCtx := errgroup.WithContext(ctx)
+	return &collection{parent: ctx, group: group, ctx: groupCtx, data: data}
+}
+
+// step runs fn in its own goroutine. An error from fn fails the collection,
+// or in best-effort mode is recorded as a failed step; if the caller's context
+// ended first, the error is attributed to the step it interrupted.
+func (c *collection) step(name string, fn func(ctx context.Context) error) {
+	c.group.Go(func() error {
+		if c.ctx.Err() == nil {
+			logrus.WithField("step", name).Debug("collection step")
+			err := fn(c.ctx)
+			if err != nil && c.bestEffort && c.parent.Err() == nil {
+				logrus.WithField("step", name).WithError(err).Warn("collection step failed, continuing in best-effort mode")
+				c.mu.Lock()
+				c.failed = append(c.failed, name)
+				c.mu.Unlock()
+				return nil
+			}
+			if err == nil || c.parent.Err() == nil {
+				return err
+			}
+		}
+		if err := c.parent.Err(); err != nil {
+			logrus.WithField("step", name).WithError(err).Warn("collection interrupted")
+			return fmt.Errorf("collection interrupted during %s: %w", name, err)
+		}
+		// Cancelled because another step failed; that error is reported instead.
+		return nil
+	})
+}
+
+// update applies fn to the payload while holding the lock.
+func (c *collection) update(fn func(data *Data)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c.data)
+}
+
+// wait blocks until all steps finish. Detection steps that degraded because
+// the caller's context ended still fail the collection, so a partial payload
+// is never returned.
+func (c *collection) wait() error {
+	if err := c.group.Wait(); err != nil {
+		return err
 	}
-	logrus.WithFields(logrus.Fields{"plugin": cniPlugin, "version": cniVersion}).Debug("detected CNI")
+	if err := c.parent.Err(); err != nil {
+		logrus.WithError(err).Warn("collection interrupted")
+		return fmt.Errorf("collection interrupted: %w", err)
+	}
+	return nil
+}
 
-	logrus.Debug("detecting ingress controller")
-	ingressController, ingressVersion := detectIngressController(kubeSystemDeploy.Items, kubeSystemDS.Items)
-	data.ExtraFieldInfo["ingress-controller"] = ingressController
-	if ingressVersion != "" {
-		data.ExtraFieldInfo["ingress-version"] = ingressVersion
+// serverVersion wraps the discovery call, which does not take a context, so
+// that it still honors cancellation.
+func serverVersion(ctx context.Context, clientset kubernetes.Interface) (*version.Info, error) {
+	type result struct {
+		info *version.Info
+		err  error
 	}
-	logrus.WithFields(logrus.Fields{"controller": ingressController, "version": ingressVersion}).Debug("detected ingress")
+	ch := make(chan result, 1)
+	go func() {
+		info, err := clientset.Discovery().ServerVersion()
+		ch <- result{info, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.info, r.err
+	}
+}
+
+// signBody returns the X-Signature value for body: "sha256=" followed by the
+// hex HMAC-SHA256 of body under key.
+func signBody(body []byte, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VersionCache holds the server version between collections in periodic
+// mode, where it rarely changes between runs. It is safe for concurrent use.
+type VersionCache struct {
+	refreshEvery int
 
-	logrus.Debug("detecting GPU operator")
-	gpuOperator, gpuOperatorVersion := detectGPUOperator(ctx, clientset)
-	if gpuOperator != "none" {
-		data.ExtraFieldInfo["gpu-operator"] = gpuOperator
-		if gpuOperatorVersion != "" {
-			data.ExtraFieldInfo["gpu-operator-version"] = gpuOperatorVersion
+	mu   sync.Mutex
+	info *version.Info
+	uses int
+}
+
+// NewVersionCache returns a cache that fetches the server version again
+// every refreshEvery collections. Values below 2 disable caching.
+func NewVersionCache(refreshEvery int) *VersionCache {
+	return &VersionCache{refreshEvery: refreshEvery}
+}
+
+// get returns the cached version, fetching it when the cache is empty or
+// due for refresh. A nil cache always fetches. Failed fetches are not cached.
+func (v *VersionCache) get(ctx context.Context, clientset kubernetes.Interface) (*version.Info, error) {
+	if v == nil {
+		return serverVersion(ctx, clientset)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.info == nil || v.uses >= v.refreshEvery {
+		info, err := serverVersion(ctx, clientset)
+		if err != nil {
+			v.info = nil
+			return nil, err
 		}
+		v.info, v.uses = info, 0
 	}
-	logrus.WithFields(logrus.Fields{"operator": gpuOperator, "version": gpuOperatorVersion}).Debug("detected GPU operator")
+	v.uses++
+	return v.info, nil
+}
 
-	logrus.Debug("detecting Rancher Manager")
-	rancherManaged, rancherVersion, rancherInstallUUID := detectRancherManager(ctx, clientset)
-	data.ExtraFieldInfo["rancher-managed"] = rancherManaged
-	if isMinimal {
-		data.ExtraFieldInfo["rancher-version"] = ""
-		data.ExtraFieldInfo["rancher-install-uuid"] = ""
+// FailureStreaks counts consecutive failed deliveries per endpoint, so that
+// periodic mode can back off between cycles during an outage and return to
+// the base interval as soon as a send succeeds. It is safe for concurrent use.
+type FailureStreaks struct {
+	mu      sync.Mutex
+	streaks map[string]int
+}
+
+// NewFailureStreaks returns streaks with no failures recorded.
+func NewFailureStreaks() *FailureStreaks {
+	return &FailureStreaks{streaks: make(map[string]int)}
+}
+
+// record resets the endpoint's streak on success or extends it on failure,
+// and returns the new streak. A nil FailureStreaks records nothing.
+func (f *FailureStreaks) record(endpoint string, err error) int {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.streaks[endpoint] = 0
 	} else {
-		if rancherVersion != "" {
-			data.ExtraFieldInfo["rancher-version"] = rancherVersion
+		f.streaks[endpoint]++
+	}
+	endpointFailureStreak.WithLabelValues(endpoint).Set(float64(f.streaks[endpoint]))
+	return f.streaks[endpoint]
+}
+
+// Delay returns the time until the next cycle: base while any endpoint is
+// succeeding, doubled for each cycle in which every endpoint failed, up to
+// maxDelay. A nil FailureStreaks always returns base.
+func (f *FailureStreaks) Delay(base, maxDelay time.Duration) time.Duration {
+	if f == nil {
+		return base
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failures := -1
+	for _, streak := range f.streaks {
+		if failures < 0 || streak < failures {
+			failures = streak
+		}
+	}
+	delay := base
+	for i := 0; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	cycleDelay.Set(delay.Seconds())
+	return delay
+}
+
+// SendAll delivers data to each endpoint independently, each with its own
+// retries. It fails when no endpoint succeeded, or when any failed and
+// requireAll is set. Endpoints skipped by an open breaker count as failed
+// with ErrCircuitOpen.
+func SendAll(ctx context.Context, data *Data, endpoints []string, opts SendOptions, requireAll bool) error {
+	var errs []error
+	for _, endpoint := range endpoints {
+		if ok, remaining := opts.Breaker.allow(endpoint); !ok {
+			logrus.WithFields(logrus.Fields{"endpoint": endpoint, "probeIn": remaining.Round(time.Second)}).Info("circuit breaker open, skipping endpoint")
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, ErrCircuitOpen))
+			continue
 		}
-		if rancherInstallUUID != "" {
-			data.ExtraFieldInfo["rancher-install-uuid"] = rancherInstallUUID
+		_, err := Send(ctx, data, endpoint, opts)
+		opts.Breaker.record(endpoint, err)
+		streak := opts.Streaks.record(endpoint, err)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"endpoint": endpoint, "failureStreak": streak}).WithError(err).Warn("endpoint delivery failed")
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
 		}
+		logrus.WithField("endpoint", endpoint).Info("endpoint delivery succeeded")
 	}
-	logrus.WithFields(logrus.Fields{"managed": rancherManaged, "version": rancherVersion, "installUUID": rancherInstallUUID}).Debug("detected Rancher")
+	if len(errs) == 0 || (!requireAll && len(errs) < len(endpoints)) {
+		return nil
+	}
+	return fmt.Errorf("failed to send to %d of %d endpoints: %w", len(errs), len(endpoints), errors.Join(errs...))
+}
 
-	logrus.Debug("detecting IP stack configuration")
-	ipStack := detectIPStack(ctx, clientset)
-	data.ExtraFieldInfo["ip-stack"] = ipStack
-	logrus.WithField("ip-stack", ipStack).Debug("detected IP stack")
+// expandEndpoint replaces clusterUUIDPlaceholder in endpoint with the
+// payload's path-escaped cluster UUID, for receivers that key resources by
+// cluster, e.g. PUT https://example.com/clusters/{clusterUUID}.
+func expandEndpoint(endpoint string, data *Data) (string, error) {
+	if !strings.Contains(endpoint, clusterUUIDPlaceholder) {
+		return endpoint, nil
+	}
+	clusterUUID := data.ExtraTagInfo["clusteruuid"]
+	if clusterUUID == "" {
+		return "", fmt.Errorf("endpoint uses %s but the payload has no cluster UUID", clusterUUIDPlaceholder)
+	}
+	return strings.ReplaceAll(endpoint, clusterUUIDPlaceholder, url.PathEscape(clusterUUID)), nil
+}
 
-	return data, nil
+func Send(ctx context.Context, data *Data, endpoint string, opts SendOptions) (*Response, error) {
+	start := time.Now()
+	resp, err := send(ctx, data, endpoint, opts)
+	sendDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		sendsTotal.WithLabelValues("failure").Inc()
+	} else {
+		sendsTotal.WithLabelValues("success").Inc()
+	}
+	return resp, err
 }
 
-func Send(ctx context.Context, data *Data, endpoint string) (*Response, error) {
-	jsonData, err := json.Marshal(data)
+func send(ctx context.Context, data *Data, endpoint string, opts SendOptions) (*Response, error) {
+	endpoint, err := expandEndpoint(endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := marshalPayload(data, opts.Format, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal data: %w", err)
 	}
 
 	logrus.WithField("endpoint", endpoint).Info("sending data")
 	logrus.WithField("size", len(jsonData)).Debug("request payload")
+	if opts.Format == FormatGRPC {
+		return nil, sendGRPC(ctx, jsonData, endpoint, data, opts)
+	}
+
+	// The body is prepared once and reused across retries. Remote-write
+	// bodies are snappy-compressed by the format itself.
+	body := jsonData
+	if opts.Compress && opts.Format != FormatRemoteWrite {
+		body, err = gzipBytes(jsonData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress data: %w", err)
+		}
+		logrus.WithFields(logrus.Fields{"size": len(jsonData), "compressedSize": len(body)}).Debug("compressed payload")
+	}
 
-	client := &http.Client{Timeout: defaultTimeout}
+	// The signature covers the bytes on the wire, after compression.
+	var signature string
+	if opts.HMACKey != "" {
+		signature = signBody(body, opts.HMACKey)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	// Requests to a Unix domain socket keep their HTTP semantics; only the
+	// connection differs.
+	requestURL := endpoint
+	if path, ok := socketPath(endpoint); ok {
+		client = unixSocketClient(client, path)
+		requestURL = "http://" + unixSocketHost + "/"
+	}
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	method := opts.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	// Every attempt carries the same key, so a receiver that stored an
+	// attempt whose response was lost can drop the retry.
+	reportID := data.ExtraTagInfo[reportIDKey]
 
 	var lastErr error
-	for attempt := 1; attempt <= maxRetries; attempt++ {
+	var retryAfter time.Duration
+	var hasRetryAfter bool
+	maxAttempts := opts.MaxRetries + 1
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		if attempt > 1 {
-			delay := time.Duration(attempt-1) * retryDelay
-			logrus.WithFields(logrus.Fields{"attempt": attempt, "max": maxRetries, "delay": delay}).Info("retrying")
-			time.Sleep(delay)
+			delay := backoffDelay(attempt-1, opts.RetryDelay, opts.MaxRetryDelay)
+			if hasRetryAfter {
+				delay = retryAfter
+				hasRetryAfter = false
+			}
+			logrus.WithFields(logrus.Fields{"attempt": attempt, "max": maxAttempts, "delay": delay}).Info("retrying")
+			sendRetriesTotal.Inc()
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, fmt.Errorf("retry aborted: %w", err)
+			}
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		if reportID != "" {
+			req.Header.Set("X-Idempotency-Key", reportID)
+		}
+		if data.SchemaVersion != "" {
+			req.Header.Set("X-Schema-Version", data.SchemaVersion)
+		}
+		switch {
+		case opts.Format == FormatRemoteWrite:
+			req.Header.Set("Content-Type", "application/x-protobuf")
+			req.Header.Set("Content-Encoding", "snappy")
+			req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		case opts.Compress:
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+		default:
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if opts.AuthToken != "" {
+			req.Header.Set("Authorization", "Bearer "+opts.AuthToken)
+		}
+		if signature != "" {
+			req.Header.Set("X-Signature", signature)
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -247,7 +1071,7 @@ func Send(ctx context.Context, data *Data, endpoint string) (*Response, error) {
 			continue
 		}
 
-		body, err := io.ReadAll(resp.Body)
+		respBody, err := io.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		if err != nil {
 			lastErr = fmt.Errorf("failed to read response: %w", err)
@@ -257,12 +1081,32 @@ func Send(ctx context.Context, data *Data, endpoint string) (*Response, error) {
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			logrus.WithField("attempt", attempt).WithError(lastErr).Warn("attempt failed")
+			// Receivers usually explain a rejection in the body.
+			log := logrus.WithFields(logrus.Fields{
+				"attempt":      attempt,
+				"responseBody": responseSnippet(respBody, opts.AuthToken, opts.HMACKey),
+			})
+			if !retryableStatus(resp.StatusCode) {
+				// Rejections such as 400 or 401 will not change on retry.
+				log.WithError(lastErr).Warn("attempt failed, not retrying")
+				return nil, lastErr
+			}
+			log.WithError(lastErr).Warn("attempt failed")
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				retryAfter, hasRetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			}
 			continue
 		}
 
+		// OTLP collectors and remote-write receivers do not answer with
+		// version information.
+		if opts.Format == FormatOTLP || opts.Format == FormatRemoteWrite {
+			logrus.WithField("attempt", attempt).Info("data sent")
+			return nil, nil
+		}
+
 		var response Response
-		if err := json.Unmarshal(body, &response); err != nil {
+		if err := json.Unmarshal(respBody, &response); err != nil {
 			logrus.WithError(err).Warn("failed to parse response")
 			logrus.WithField("attempt", attempt).Info("data sent")
 			return nil, nil
@@ -283,15 +1127,142 @@ func Send(ctx context.Context, data *Data, endpoint string) (*Response, error) {
 	return nil, lastErr
 }
 
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// backoffDelay returns the sleep before the given retry (1-based): exponential in
+// base, capped at maxDelay, with full jitter so that a fleet does not retry in lockstep.
+func backoffDelay(retry int, base, maxDelay time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base
+	for i := 1; i < retry; i++ {
+		if maxDelay > 0 && ceiling >= maxDelay {
+			break
+		}
+		ceiling *= 2
+	}
+	if maxDelay > 0 && ceiling > maxDelay {
+		ceiling = maxDelay
+	}
+	return rand.N(ceiling + 1) // #nosec G404 -- jitter does not need a CSPRNG
+}
+
+// maxLoggedResponseBody caps how much of an error response is logged.
+const maxLoggedResponseBody = 512
+
+// credentialPatterns match credentials a receiver might echo back in an error
+// body: authorization schemes, JWTs, and values of credential-like keys.
+var credentialPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 [REDACTED]"},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), "[REDACTED]"},
+	{regexp.MustCompile(`(?i)((?:token|api[_-]?key|secret|password|signature|authorization)"?\s*[:=]\s*"?)[^"\s,&}]+`), "${1}[REDACTED]"},
+}
+
+// responseSnippet returns body for logging, with the given secrets and
+// anything that looks like a credential redacted, truncated to
+// maxLoggedResponseBody bytes.
+func responseSnippet(body []byte, secrets ...string) string {
+	snippet := string(body)
+	for _, secret := range secrets {
+		if secret != "" {
+			snippet = strings.ReplaceAll(snippet, secret, "[REDACTED]")
+		}
+	}
+	for _, p := range credentialPatterns {
+		snippet = p.re.ReplaceAllString(snippet, p.repl)
+	}
+	if len(snippet) > maxLoggedResponseBody {
+		snippet = strings.ToValidUTF8(snippet[:maxLoggedResponseBody], "") + "...(truncated)"
+	}
+	return snippet
+}
+
+// retryableStatus reports whether a failed request may succeed when retried:
+// request timeouts, rate limiting, and server errors.
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header in either delay-seconds or
+// HTTP-date form, capped at maxRetryAfter.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+	} else {
+		return 0, false
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d, true
+}
+
+// sleepContext sleeps for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func isControlPlaneNode(node *corev1.Node) bool {
 	_, hasControlPlaneLabel := node.Labels["node-role.kubernetes.io/control-plane"]
 	_, hasMasterLabel := node.Labels["node-role.kubernetes.io/master"]
 	return hasControlPlaneLabel || hasMasterLabel
 }
 
+// selinuxEnforcingDistros are OS image prefixes of distributions that ship
+// with SELinux enforcing by default.
+var selinuxEnforcingDistros = []string{
+	"Red Hat Enterprise Linux",
+	"Rocky Linux",
+	"AlmaLinux",
+	"CentOS",
+	"Fedora",
+	"Oracle Linux",
+	"SL Micro",
+	"SLE Micro",
+	"SUSE Linux Micro",
+	"openSUSE Leap Micro",
+	"openSUSE MicroOS",
+}
+
 // getSELinuxStatus determines SELinux status from node labels.
 // SELinux detection is limited from within containers; this is a best-effort
-// approach. Returns "unknown" if not determinable.
+// approach. Without a label, nodes running a distribution that enforces
+// SELinux by default are reported as "likely-enabled", since the actual
+// mode cannot be read. Returns "unknown" if not determinable.
 func getSELinuxStatus(node *corev1.Node) string {
 	if selinux, ok := node.Labels["security.alpha.kubernetes.io/selinux"]; ok {
 		if selinux == "enabled" {
@@ -299,9 +1270,43 @@ func getSELinuxStatus(node *corev1.Node) string {
 		}
 		return "disabled"
 	}
+	for _, distro := range selinuxEnforcingDistros {
+		if strings.HasPrefix(node.Status.NodeInfo.OSImage, distro) {
+			return "likely-enabled"
+		}
+	}
 	return "unknown"
 }
 
+// kubernetesVersionTags returns the server's major and minor versions and
+// its GitVersion as a semver with neither the "v" prefix nor build metadata,
+// e.g. "1.32.2" for "v1.32.2+rke2r1". Some distributions report Minor as
+// "28+", so only its leading digits are kept; when Major or Minor is empty
+// it is taken from GitVersion instead. Unparseable values are returned empty.
+func kubernetesVersionTags(info *version.Info) (major, minor, semver string) {
+	major, minor = leadingDigits(info.Major), leadingDigits(info.Minor)
+	v, err := utilversion.ParseSemantic(info.GitVersion)
+	if err != nil {
+		return major, minor, ""
+	}
+	if major == "" {
+		major = strconv.FormatUint(uint64(v.Major()), 10)
+	}
+	if minor == "" {
+		minor = strconv.FormatUint(uint64(v.Minor()), 10)
+	}
+	return major, minor, v.WithBuildMetadata("").String()
+}
+
+// leadingDigits returns the decimal digits s starts with.
+func leadingDigits(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		return s
+	}
+	return s[:end]
+}
+
 func extractImageVersion(image string) string {
 	if idx := strings.LastIndex(image, ":"); idx != -1 {
 		tag := image[idx+1:]
@@ -313,71 +1318,121 @@ func extractImageVersion(image string) string {
 	return ""
 }
 
-func detectCNIPlugin(daemonSets []appsv1.DaemonSet) (string, string) {
-	cniPatterns := map[string]string{
-		"canal":   "canal",
-		"flannel": "flannel",
-		"calico":  "calico",
-		"cilium":  "cilium",
-		"weave":   "weave",
-	}
+// cniPatterns maps DaemonSet name fragments to CNI names, in order of
+// precedence. kube-ovn runs several DaemonSets, so its CNI agent is matched
+// before the generic "ovn" fragment. Multus is a meta-plugin layered over
+// another CNI and only becomes primary when nothing else is found.
+var cniPatterns = []struct {
+	pattern string
+	name    string
+}{
+	{"canal", "canal"},
+	{"flannel", "flannel"},
+	{"calico", "calico"},
+	{"cilium", "cilium"},
+	{"weave", "weave"},
+	{"antrea", "antrea"},
+	{"kube-ovn-cni", "kube-ovn"},
+	{"kube-ovn", "kube-ovn"},
+	{"ovn", "kube-ovn"},
+	{"multus", "multus"},
+}
 
-	for _, ds := range daemonSets {
-		name := strings.ToLower(ds.Name)
-		for pattern, cniName := range cniPatterns {
-			if strings.Contains(name, pattern) {
-				version := ""
+// detectCNIPlugin returns the primary CNI and its version, plus every
+// detected CNI sorted by name.
+func detectCNIPlugin(daemonSets []appsv1.DaemonSet) (string, string, []string) {
+	primary, version := "unknown", ""
+	seen := make(map[string]bool)
+	for _, p := range cniPatterns {
+		for _, ds := range daemonSets {
+			if !strings.Contains(strings.ToLower(ds.Name), p.pattern) {
+				continue
+			}
+			if primary == "unknown" {
+				primary = p.name
 				if len(ds.Spec.Template.Spec.Containers) > 0 {
 					version = extractImageVersion(ds.Spec.Template.Spec.Containers[0].Image)
 				}
-				return cniName, version
 			}
+			seen[p.name] = true
 		}
 	}
 
-	return "unknown", ""
+	plugins := make([]string, 0, len(seen))
+	for name := range seen {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	return primary, version, plugins
 }
 
+// detectCNIPluginOutsideKubeSystem searches the given namespaces, or all
+// namespaces when none are given, for CNIs installed outside kube-system.
+// List failures (e.g. RBAC) leave the result "unknown".
+func detectCNIPluginOutsideKubeSystem(ctx context.Context, clientset kubernetes.Interface, namespaces []string) (string, string, []string) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var daemonSets []appsv1.DaemonSet
+	for _, ns := range namespaces {
+		list, err := clientset.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			logrus.WithField("namespace", ns).WithError(err).Warn("failed to list daemonsets for CNI detection")
+			continue
+		}
+		daemonSets = append(daemonSets, list.Items...)
+	}
+	return detectCNIPlugin(daemonSets)
+}
+
+// detectIngressController returns the ingress controller found in
+// kube-system and the image of its first container, or "none" and "".
 func detectIngressController(deployments []appsv1.Deployment, daemonSets []appsv1.DaemonSet) (string, string) {
 	for _, deploy := range deployments {
-		name := strings.ToLower(deploy.Name)
-		var ingressName string
-		switch {
-		case strings.Contains(name, "nginx-ingress"), strings.Contains(name, "rke2-ingress-nginx"):
-			ingressName = "rke2-ingress-nginx"
-		case strings.Contains(name, "traefik"):
-			ingressName = "traefik"
-		}
-		if ingressName != "" {
-			version := ""
-			if len(deploy.Spec.Template.Spec.Containers) > 0 {
-				version = extractImageVersion(deploy.Spec.Template.Spec.Containers[0].Image)
-			}
-			return ingressName, version
+		if name := ingressControllerName(deploy.Name); name != "" {
+			return name, firstImage(deploy.Spec.Template.Spec)
 		}
 	}
-
 	for _, ds := range daemonSets {
-		name := strings.ToLower(ds.Name)
-		var ingressName string
-		switch {
-		case strings.Contains(name, "nginx-ingress"), strings.Contains(name, "rke2-ingress-nginx"):
-			ingressName = "rke2-ingress-nginx"
-		case strings.Contains(name, "traefik"):
-			ingressName = "traefik"
-		}
-		if ingressName != "" {
-			version := ""
-			if len(ds.Spec.Template.Spec.Containers) > 0 {
-				version = extractImageVersion(ds.Spec.Template.Spec.Containers[0].Image)
-			}
-			return ingressName, version
+		if name := ingressControllerName(ds.Name); name != "" {
+			return name, firstImage(ds.Spec.Template.Spec)
 		}
 	}
-
 	return "none", ""
 }
 
+// ingressControllerName maps a workload name to the ingress controller it
+// runs, or "".
+func ingressControllerName(workload string) string {
+	name := strings.ToLower(workload)
+	switch {
+	case strings.Contains(name, "nginx-ingress"), strings.Contains(name, "rke2-ingress-nginx"):
+		return "rke2-ingress-nginx"
+	case strings.Contains(name, "traefik"):
+		return "traefik"
+	}
+	return ""
+}
+
+func firstImage(spec corev1.PodSpec) string {
+	if len(spec.Containers) == 0 {
+		return ""
+	}
+	return spec.Containers[0].Image
+}
+
+// imageTag returns the tag of an image reference, ignoring any digest and a
+// registry port, or "" for an untagged image such as one pinned only by
+// digest.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, ok := strings.Cut(name, ":"); ok {
+		return tag
+	}
+	return ""
+}
+
 func detectGPUOperator(ctx context.Context, clientset kubernetes.Interface) (string, string) {
 	gpuNamespaces := map[string]string{
 		"gpu-operator":              "nvidia-gpu-operator",
@@ -405,19 +1460,40 @@ func detectGPUOperator(ctx context.Context, clientset kubernetes.Interface) (str
 	return "none", ""
 }
 
-func detectRancherManager(ctx context.Context, clientset kubernetes.Interface) (managed bool, version, installUUID string) {
-	_, err := clientset.CoreV1().Namespaces().Get(ctx, "cattle-system", metav1.GetOptions{})
+// detectRancherManager reports whether the cluster is managed by Rancher:
+// the cattle-system namespace exists, and the cattle-cluster-agent
+// Deployment (or DaemonSet) supplies the agent version and install UUID.
+// Lookup failures other than NotFound (e.g. RBAC) are returned so the
+// caller can omit the fields instead of reporting a false negative.
+func detectRancherManager(ctx context.Context, clientset kubernetes.Interface) (managed bool, version, installUUID string, err error) {
+	_, err = clientset.CoreV1().Namespaces().Get(ctx, "cattle-system", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, "", "", nil
+	}
 	if err != nil {
-		return false, "", ""
+		return false, "", "", err
 	}
 
-	deploy, err := clientset.AppsV1().Deployments("cattle-system").Get(ctx, "cattle-cluster-agent", metav1.GetOptions{})
+	var podSpec *corev1.PodSpec
+	deploy, err := findDeployment(ctx, clientset, "cattle-system", "cattle-cluster-agent")
 	if err != nil {
-		return true, "", ""
+		return false, "", "", err
+	}
+	if deploy != nil {
+		podSpec = &deploy.Spec.Template.Spec
+	} else {
+		ds, err := clientset.AppsV1().DaemonSets("cattle-system").Get(ctx, "cattle-cluster-agent", metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return false, "", "", err
+		default:
+			podSpec = &ds.Spec.Template.Spec
+		}
 	}
 
-	if len(deploy.Spec.Template.Spec.Containers) > 0 {
-		container := deploy.Spec.Template.Spec.Containers[0]
+	if podSpec != nil && len(podSpec.Containers) > 0 {
+		container := podSpec.Containers[0]
 		version = extractImageVersion(container.Image)
 		for _, env := range container.Env {
 			if env.Name == "CATTLE_INSTALL_UUID" && env.Value != "" {
@@ -426,7 +1502,7 @@ func detectRancherManager(ctx context.Context, clientset kubernetes.Interface) (
 			}
 		}
 	}
-	return true, version, installUUID
+	return true, version, installUUID, nil
 }
 
 // detectIPStack determines the cluster's IP stack configuration from the kubernetes service.
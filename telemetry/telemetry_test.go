@@ -1,19 +1,37 @@
 package telemetry
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	goruntime "runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestExtractImageVersion(t *testing.T) {
@@ -41,6 +59,54 @@ func TestExtractImageVersion(t *testing.T) {
 	}
 }
 
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"rancher/nginx-ingress-controller:v1.12.1-hardened1", "v1.12.1-hardened1"},
+		{"registry.example.com:5000/traefik:2.11.10", "2.11.10"},
+		{"registry.example.com:5000/traefik", ""},
+		{"traefik:2.11.10@sha256:abc123", "2.11.10"},
+		{"traefik@sha256:abc123", ""},
+		{"traefik", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageTag(tt.image); got != tt.want {
+				t.Errorf("imageTag(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesVersionTags(t *testing.T) {
+	tests := []struct {
+		name                             string
+		info                             version.Info
+		wantMajor, wantMinor, wantSemver string
+	}{
+		{"rke2", version.Info{Major: "1", Minor: "32", GitVersion: "v1.32.2+rke2r1"}, "1", "32", "1.32.2"},
+		{"plus minor", version.Info{Major: "1", Minor: "28+", GitVersion: "v1.28.3-eks-4f4795d"}, "1", "28", "1.28.3-eks-4f4795d"},
+		{"release candidate", version.Info{Major: "1", Minor: "33", GitVersion: "v1.33.0-rc.1+rke2r1"}, "1", "33", "1.33.0-rc.1"},
+		{"empty major and minor", version.Info{GitVersion: "v1.30.1"}, "1", "30", "1.30.1"},
+		{"unparseable git version", version.Info{Major: "1", Minor: "29", GitVersion: "dev"}, "1", "29", ""},
+		{"empty", version.Info{}, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			major, minor, semver := kubernetesVersionTags(&tt.info)
+			if major != tt.wantMajor || minor != tt.wantMinor || semver != tt.wantSemver {
+				t.Errorf("kubernetesVersionTags() = %q, %q, %q, want %q, %q, %q",
+					major, minor, semver, tt.wantMajor, tt.wantMinor, tt.wantSemver)
+			}
+		})
+	}
+}
+
 func TestIsControlPlaneNode(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -89,6 +155,7 @@ func TestGetSELinuxStatus(t *testing.T) {
 	tests := []struct {
 		name     string
 		labels   map[string]string
+		osImage  string
 		expected string
 	}{
 		{
@@ -96,6 +163,24 @@ func TestGetSELinuxStatus(t *testing.T) {
 			labels:   map[string]string{"security.alpha.kubernetes.io/selinux": "enabled"},
 			expected: "enabled",
 		},
+		{
+			name:     "label wins over OS image",
+			labels:   map[string]string{"security.alpha.kubernetes.io/selinux": "disabled"},
+			osImage:  "Red Hat Enterprise Linux 9.4 (Plow)",
+			expected: "disabled",
+		},
+		{
+			name:     "enforcing distro",
+			labels:   map[string]string{},
+			osImage:  "SL Micro 6.0",
+			expected: "likely-enabled",
+		},
+		{
+			name:     "other distro",
+			labels:   map[string]string{},
+			osImage:  "Ubuntu 22.04.4 LTS",
+			expected: "unknown",
+		},
 		{
 			name:     "disabled",
 			labels:   map[string]string{"security.alpha.kubernetes.io/selinux": "disabled"},
@@ -115,7 +200,10 @@ func TestGetSELinuxStatus(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}}
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.labels},
+				Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: tt.osImage}},
+			}
 			result := getSELinuxStatus(node)
 			if result != tt.expected {
 				t.Errorf("getSELinuxStatus() = %q, want %q", result, tt.expected)
@@ -167,7 +255,7 @@ func TestCollect_BasicCluster(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -192,6 +280,102 @@ func TestCollect_BasicCluster(t *testing.T) {
 	}
 }
 
+func TestCollect_TimestampAndDuration(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+	)
+
+	before := time.Now().Truncate(time.Second)
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "minimal"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	ts, err := time.Parse(time.RFC3339, data.ExtraFieldInfo["timestamp"].(string))
+	if err != nil {
+		t.Fatalf("timestamp %v is not RFC3339: %v", data.ExtraFieldInfo["timestamp"], err)
+	}
+	if ts.Before(before) || ts.After(time.Now()) {
+		t.Errorf("timestamp = %v, want the collection start", ts)
+	}
+	if d, ok := data.ExtraFieldInfo["collectionDurationMs"].(int64); !ok || d < 0 {
+		t.Errorf("collectionDurationMs = %v, want a non-negative int64", data.ExtraFieldInfo["collectionDurationMs"])
+	}
+}
+
+func TestCollect_RuntimeStats(t *testing.T) {
+	keys := []string{"responderGoVersion", "responderMemAllocBytes", "responderGoroutines"}
+	for _, include := range []bool{false, true} {
+		t.Run(fmt.Sprintf("include=%v", include), func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", IncludeRuntimeStats: include})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			for _, key := range keys {
+				if _, ok := data.ExtraFieldInfo[key]; ok != include {
+					t.Errorf("%s present = %v, want %v", key, ok, include)
+				}
+			}
+			if !include {
+				return
+			}
+			if got := data.ExtraFieldInfo["responderGoVersion"]; got != goruntime.Version() {
+				t.Errorf("responderGoVersion = %v, want %s", got, goruntime.Version())
+			}
+			if got, ok := data.ExtraFieldInfo["responderMemAllocBytes"].(uint64); !ok || got == 0 {
+				t.Errorf("responderMemAllocBytes = %v, want a positive uint64", data.ExtraFieldInfo["responderMemAllocBytes"])
+			}
+			if got, ok := data.ExtraFieldInfo["responderGoroutines"].(int); !ok || got < 1 {
+				t.Errorf("responderGoroutines = %v, want at least 1", data.ExtraFieldInfo["responderGoroutines"])
+			}
+		})
+	}
+}
+
+func TestCollect_CalicoAndTraefik(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "server-1",
+				Labels: map[string]string{"node-role.kubernetes.io/control-plane": ""},
+			},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "calico-node", Namespace: "kube-system"},
+			Spec: appsv1.DaemonSetSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "docker.io/calico/node:v3.27.2"}}},
+				},
+			},
+		},
+		deployment("kube-system", "rke2-traefik", "rancher/mirrored-library-traefik:2.11.10"),
+	)
+
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"cni-plugin":         "calico",
+		"cni-plugins":        []string{"calico"},
+		"cni-version":        "v3.27.2",
+		"ingress-controller": "traefik",
+		"ingress-version":    "2.11.10",
+		"serverNodeCount":    1,
+		"agentNodeCount":     0,
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(data.ExtraFieldInfo[key], value) {
+			t.Errorf("%s = %v, want %v", key, data.ExtraFieldInfo[key], value)
+		}
+	}
+}
+
 func TestCollect_CNIDetection(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -204,6 +388,9 @@ func TestCollect_CNIDetection(t *testing.T) {
 		{"calico", "calico-node", "calico/node:v3.26.0", "calico"},
 		{"cilium", "cilium", "cilium/cilium:v1.14.0", "cilium"},
 		{"weave", "weave-net", "weaveworks/weave-kube:2.8.1", "weave"},
+		{"antrea", "antrea-agent", "antrea/antrea-agent-ubuntu:v1.15.0", "antrea"},
+		{"kube-ovn", "kube-ovn-cni", "kubeovn/kube-ovn:v1.12.4", "kube-ovn"},
+		{"ovn", "ovs-ovn", "kubeovn/kube-ovn:v1.12.4", "kube-ovn"},
 	}
 
 	for _, tt := range tests {
@@ -226,7 +413,7 @@ func TestCollect_CNIDetection(t *testing.T) {
 				},
 			)
 
-			data, err := Collect(context.Background(), clientset, "recommended")
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 			if err != nil {
 				t.Fatalf("Collect() error = %v", err)
 			}
@@ -238,15 +425,251 @@ func TestCollect_CNIDetection(t *testing.T) {
 	}
 }
 
+func TestCollect_CNIOutsideKubeSystem(t *testing.T) {
+	ciliumDS := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "cilium", Namespace: "cilium"},
+		Spec: appsv1.DaemonSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "cilium/cilium:v1.14.0"}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		namespaces  []string
+		denyList    bool
+		expectedCNI string
+	}{
+		{"all namespaces", nil, false, "cilium"},
+		{"configured namespace", []string{"cilium"}, false, "cilium"},
+		{"other namespace configured", []string{"networking"}, false, "unknown"},
+		{"rbac denied", nil, true, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+				ciliumDS,
+			)
+			if tt.denyList {
+				clientset.PrependReactor("list", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.GetNamespace() == "kube-system" {
+						return false, nil, nil
+					}
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "daemonsets"}, "", errors.New("denied"))
+				})
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", CNINamespaces: tt.namespaces})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if data.ExtraFieldInfo["cni-plugin"] != tt.expectedCNI {
+				t.Errorf("cni-plugin = %v, want %v", data.ExtraFieldInfo["cni-plugin"], tt.expectedCNI)
+			}
+		})
+	}
+}
+
+func TestCollect_CNIEdgeCases(t *testing.T) {
+	daemonSet := func(namespace, name, image string) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: appsv1.DaemonSetSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: image}}},
+				},
+			},
+		}
+	}
+	// deny fails daemonset lists in the given namespaces ("" for all).
+	deny := func(namespaces ...string) func(*fake.Clientset) {
+		return func(clientset *fake.Clientset) {
+			clientset.PrependReactor("list", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				for _, ns := range namespaces {
+					if action.GetNamespace() == ns {
+						return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "daemonsets"}, "", errors.New("denied"))
+					}
+				}
+				return false, nil, nil
+			})
+		}
+	}
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		namespaces  []string
+		reactor     func(*fake.Clientset)
+		wantPlugin  interface{}
+		wantVersion interface{}
+		wantPlugins interface{}
+	}{
+		{
+			name:        "no CNI",
+			wantPlugin:  "unknown",
+			wantPlugins: []string{},
+		},
+		{
+			name:        "one CNI",
+			objects:     []runtime.Object{daemonSet("kube-system", "rke2-canal", "rancher/hardened-calico:v3.29.1")},
+			wantPlugin:  "canal",
+			wantVersion: "v3.29.1",
+			wantPlugins: []string{"canal"},
+		},
+		{
+			name: "multiple CNIs",
+			objects: []runtime.Object{
+				daemonSet("kube-system", "rke2-multus-ds", "rancher/hardened-multus-cni:v4.1.4"),
+				daemonSet("kube-system", "rke2-cilium", "rancher/mirrored-cilium-cilium:v1.16.4"),
+			},
+			wantPlugin:  "cilium",
+			wantVersion: "v1.16.4",
+			wantPlugins: []string{"cilium", "multus"},
+		},
+		{
+			name:        "CNI outside kube-system",
+			objects:     []runtime.Object{daemonSet("calico-system", "calico-node", "calico/node:v3.28.0")},
+			wantPlugin:  "calico",
+			wantVersion: "v3.28.0",
+			wantPlugins: []string{"calico"},
+		},
+		{
+			name:        "kube-system CNI preferred",
+			objects:     []runtime.Object{daemonSet("kube-system", "rke2-canal", "rancher/hardened-calico:v3.29.1"), daemonSet("calico-system", "calico-node", "calico/node:v3.28.0")},
+			wantPlugin:  "canal",
+			wantVersion: "v3.29.1",
+			wantPlugins: []string{"canal"},
+		},
+		{
+			name:        "RBAC denied outside kube-system",
+			objects:     []runtime.Object{daemonSet("calico-system", "calico-node", "calico/node:v3.28.0")},
+			reactor:     deny(metav1.NamespaceAll),
+			wantPlugin:  "unknown",
+			wantPlugins: []string{},
+		},
+		{
+			name:        "RBAC denied in one configured namespace",
+			objects:     []runtime.Object{daemonSet("cilium", "cilium", "cilium/cilium:v1.14.0")},
+			namespaces:  []string{"restricted", "cilium"},
+			reactor:     deny("restricted"),
+			wantPlugin:  "cilium",
+			wantVersion: "v1.14.0",
+			wantPlugins: []string{"cilium"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			}, tt.objects...)
+			clientset := fake.NewClientset(objects...)
+			if tt.reactor != nil {
+				tt.reactor(clientset)
+			}
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", CNINamespaces: tt.namespaces})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			if got := data.ExtraFieldInfo["cni-plugin"]; got != tt.wantPlugin {
+				t.Errorf("cni-plugin = %v, want %v", got, tt.wantPlugin)
+			}
+			if got := data.ExtraFieldInfo["cni-version"]; got != tt.wantVersion {
+				t.Errorf("cni-version = %v, want %v", got, tt.wantVersion)
+			}
+			if got := data.ExtraFieldInfo["cni-plugins"]; !reflect.DeepEqual(got, tt.wantPlugins) {
+				t.Errorf("cni-plugins = %v, want %v", got, tt.wantPlugins)
+			}
+		})
+	}
+
+	t.Run("kube-system RBAC denied", func(t *testing.T) {
+		clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+		deny("kube-system")(clientset)
+
+		if _, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"}); err == nil {
+			t.Error("Collect() expected error")
+		}
+		// Best-effort collection omits the CNI fields instead.
+		data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", BestEffort: true})
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		if got, ok := data.ExtraFieldInfo["cni-plugin"]; ok {
+			t.Errorf("cni-plugin = %v, want it omitted", got)
+		}
+	})
+}
+
+func TestDetectCNIPlugin_KubeOVNPrefersCNIDaemonSet(t *testing.T) {
+	daemonSet := func(name, image string) appsv1.DaemonSet {
+		return appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+			Spec: appsv1.DaemonSetSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: image}}},
+				},
+			},
+		}
+	}
+
+	plugin, version, _ := detectCNIPlugin([]appsv1.DaemonSet{
+		daemonSet("ovs-ovn", "kubeovn/ovs:v1.0.0"),
+		daemonSet("kube-ovn-pinger", "kubeovn/pinger:v2.0.0"),
+		daemonSet("kube-ovn-cni", "kubeovn/kube-ovn:v1.12.4"),
+	})
+	if plugin != "kube-ovn" || version != "v1.12.4" {
+		t.Errorf("detectCNIPlugin() = %q, %q, want kube-ovn, v1.12.4", plugin, version)
+	}
+}
+
+func TestDetectCNIPlugin_Multiple(t *testing.T) {
+	daemonSet := func(name string) appsv1.DaemonSet {
+		return appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"}}
+	}
+
+	tests := []struct {
+		name        string
+		daemonSets  []appsv1.DaemonSet
+		wantPrimary string
+		wantPlugins []string
+	}{
+		{"none", nil, "unknown", []string{}},
+		{"single", []appsv1.DaemonSet{daemonSet("calico-node")}, "calico", []string{"calico"}},
+		{"multus over calico", []appsv1.DaemonSet{daemonSet("rke2-multus-ds"), daemonSet("calico-node")}, "calico", []string{"calico", "multus"}},
+		{"multus only", []appsv1.DaemonSet{daemonSet("kube-multus-ds")}, "multus", []string{"multus"}},
+		{"kube-ovn deduplicated", []appsv1.DaemonSet{daemonSet("kube-ovn-cni"), daemonSet("ovs-ovn")}, "kube-ovn", []string{"kube-ovn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, _, plugins := detectCNIPlugin(tt.daemonSets)
+			if primary != tt.wantPrimary {
+				t.Errorf("primary = %q, want %q", primary, tt.wantPrimary)
+			}
+			if !reflect.DeepEqual(plugins, tt.wantPlugins) {
+				t.Errorf("plugins = %v, want %v", plugins, tt.wantPlugins)
+			}
+		})
+	}
+}
+
 func TestCollect_IngressDetection(t *testing.T) {
 	tests := []struct {
 		name            string
 		deploymentName  string
 		image           string
 		expectedIngress string
+		expectedVersion string
 	}{
-		{"nginx", "rke2-ingress-nginx-controller", "rancher/nginx-ingress-controller:v1.9.0", "rke2-ingress-nginx"},
-		{"traefik", "traefik", "traefik:v2.10", "traefik"},
+		{"nginx", "rke2-ingress-nginx-controller", "rancher/nginx-ingress-controller:v1.9.0", "rke2-ingress-nginx", "v1.9.0"},
+		{"traefik", "traefik", "traefik:v2.10", "traefik", "v2.10"},
+		{"digest only", "traefik", "traefik@sha256:abc123", "traefik", "unknown"},
+		{"none", "coredns", "rancher/hardened-coredns:v1.12.0", "none", ""},
 	}
 
 	for _, tt := range tests {
@@ -269,7 +692,7 @@ func TestCollect_IngressDetection(t *testing.T) {
 				},
 			)
 
-			data, err := Collect(context.Background(), clientset, "recommended")
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 			if err != nil {
 				t.Fatalf("Collect() error = %v", err)
 			}
@@ -277,6 +700,9 @@ func TestCollect_IngressDetection(t *testing.T) {
 			if data.ExtraFieldInfo["ingress-controller"] != tt.expectedIngress {
 				t.Errorf("ingress-controller = %v, want %v", data.ExtraFieldInfo["ingress-controller"], tt.expectedIngress)
 			}
+			if got, _ := data.ExtraFieldInfo["ingress-controller-version"].(string); got != tt.expectedVersion {
+				t.Errorf("ingress-controller-version = %q, want %q", got, tt.expectedVersion)
+			}
 		})
 	}
 }
@@ -301,7 +727,7 @@ func TestCollect_GPUDetection(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -339,28 +765,348 @@ func TestCollect_RancherManaged(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
-	if err != nil {
-		t.Fatalf("Collect() error = %v", err)
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	if data.ExtraFieldInfo["rancherManaged"] != true {
+		t.Errorf("rancherManaged = %v, want true", data.ExtraFieldInfo["rancherManaged"])
+	}
+	if data.ExtraFieldInfo["rancher-managed"] != true {
+		t.Errorf("rancher-managed = %v, want true", data.ExtraFieldInfo["rancher-managed"])
+	}
+	if data.ExtraFieldInfo["rancher-version"] != "v2.8.0" {
+		t.Errorf("rancher-version = %v, want v2.8.0", data.ExtraFieldInfo["rancher-version"])
+	}
+	if data.ExtraFieldInfo["rancher-install-uuid"] != "rancher-install-uuid-123" {
+		t.Errorf("rancher-install-uuid = %v, want rancher-install-uuid-123", data.ExtraFieldInfo["rancher-install-uuid"])
+	}
+}
+
+func TestCollect_RancherManagedDenied(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cattle-system"}},
+	)
+	forbidden(clientset, "get", "deployments")
+
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if got := data.ExtraFieldInfo["rancherManaged"]; got != "unknown" {
+		t.Errorf("rancherManaged = %v, want unknown", got)
+	}
+	if got, ok := data.ExtraFieldInfo["rancher-managed"]; ok {
+		t.Errorf("rancher-managed = %v, want it omitted", got)
+	}
+}
+
+func TestDetectRancherManager(t *testing.T) {
+	cattleSystem := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cattle-system"}}
+	agentDaemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "cattle-cluster-agent", Namespace: "cattle-system"},
+		Spec: appsv1.DaemonSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "rancher/rancher-agent:v2.7.5"}}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		forbidden   string
+		wantManaged bool
+		wantVersion string
+		wantErr     bool
+	}{
+		{
+			name: "not managed",
+		},
+		{
+			name:        "namespace without agent",
+			objects:     []runtime.Object{cattleSystem},
+			wantManaged: true,
+		},
+		{
+			name:        "agent deployment",
+			objects:     []runtime.Object{cattleSystem, deployment("cattle-system", "cattle-cluster-agent", "rancher/rancher-agent:v2.9.3")},
+			wantManaged: true,
+			wantVersion: "v2.9.3",
+		},
+		{
+			name:        "agent daemonset",
+			objects:     []runtime.Object{cattleSystem, agentDaemonSet},
+			wantManaged: true,
+			wantVersion: "v2.7.5",
+		},
+		{
+			name:      "namespace forbidden",
+			forbidden: "namespaces",
+			wantErr:   true,
+		},
+		{
+			name:      "agent forbidden",
+			objects:   []runtime.Object{cattleSystem},
+			forbidden: "deployments",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(tt.objects...)
+			if tt.forbidden != "" {
+				forbidden(clientset, "get", tt.forbidden)
+			}
+			managed, version, _, err := detectRancherManager(context.Background(), clientset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectRancherManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if managed != tt.wantManaged || version != tt.wantVersion {
+				t.Errorf("detectRancherManager() = %v, %q, want %v, %q", managed, version, tt.wantManaged, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCollect_MissingKubeSystem(t *testing.T) {
+	clientset := fake.NewClientset()
+
+	_, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err == nil {
+		t.Error("Collect() expected error for missing kube-system namespace")
+	}
+}
+
+func TestCollect_ContextCancelled(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Collect(ctx, clientset, CollectOptions{Mode: "recommended"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Collect() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCollect_StepFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		verb      string
+		resource  string
+		wantErr   bool
+		wantField string
+		wantValue interface{}
+	}{
+		{"nodes are fatal", "list", "nodes", true, "", nil},
+		{"kube-system namespace is fatal", "get", "namespaces", true, "", nil},
+		{"kube-system workloads are fatal", "list", "daemonsets", true, "", nil},
+		{"service mesh degrades", "get", "deployments", false, "service-mesh", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			forbidden(clientset, tt.verb, tt.resource)
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := data.ExtraFieldInfo[tt.wantField]; got != tt.wantValue {
+				t.Errorf("%s = %v, want %v", tt.wantField, got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestCollect_BestEffort(t *testing.T) {
+	tests := []struct {
+		name     string
+		verb     string
+		resource string
+		want     []string
+	}{
+		{"nodes", "list", "nodes", []string{"nodes"}},
+		{"kube-system namespace", "get", "namespaces", []string{"cluster UUID"}},
+		{"kube-system workloads", "list", "daemonsets", []string{"kube-system workloads"}},
+		{"server version", "get", "version", []string{"server version"}},
+		{"degraded steps are not listed", "list", "pods", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}},
+			)
+			forbidden(clientset, tt.verb, tt.resource)
+
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", BestEffort: true})
+			if err != nil {
+				t.Fatalf("Collect() error = %v", err)
+			}
+			got, _ := data.ExtraFieldInfo["collectionErrors"].([]string)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectionErrors = %v, want %v", got, tt.want)
+			}
+			// Steps that succeeded are still reported.
+			if _, ok := data.ExtraFieldInfo["ip-stack"]; !ok {
+				t.Error("ip-stack missing from partial payload")
+			}
+		})
+	}
+
+	t.Run("several failures are sorted", func(t *testing.T) {
+		clientset := fake.NewClientset()
+		forbidden(clientset, "list", "nodes")
+
+		data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", BestEffort: true})
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		want := []string{"cluster UUID", "nodes"}
+		if got := data.ExtraFieldInfo["collectionErrors"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("collectionErrors = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("cancellation is still fatal", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Collect(ctx, fake.NewClientset(), CollectOptions{Mode: "recommended", BestEffort: true})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Collect() error = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestVersionCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		cache       *VersionCache
+		failFirst   bool
+		runs        int
+		wantFetches int
+	}{
+		{name: "no cache", cache: nil, runs: 3, wantFetches: 3},
+		{name: "refresh every run", cache: NewVersionCache(1), runs: 3, wantFetches: 3},
+		{name: "refresh every third run", cache: NewVersionCache(3), runs: 7, wantFetches: 3},
+		{name: "failed fetch not cached", cache: NewVersionCache(5), failFirst: true, runs: 3, wantFetches: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+			var fetches int
+			clientset.PrependReactor("get", "version", func(k8stesting.Action) (bool, runtime.Object, error) {
+				fetches++
+				if tt.failFirst && fetches == 1 {
+					return true, nil, errors.New("discovery unavailable")
+				}
+				return false, nil, nil
+			})
+
+			for i := 0; i < tt.runs; i++ {
+				_, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended", VersionCache: tt.cache})
+				if (err != nil) != (tt.failFirst && i == 0) {
+					t.Fatalf("run %d: Collect() error = %v", i, err)
+				}
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("version fetches = %d, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestDataFilter(t *testing.T) {
+	data := &Data{
+		AppVersion:     "v1.30.0",
+		ExtraTagInfo:   map[string]string{"clusteruuid": "uuid", "kubernetesVersion": "v1.30.0", "reportId": "id"},
+		ExtraFieldInfo: map[string]interface{}{"cni-plugin": "canal", "serverNodeCount": 3, "os": "linux"},
+	}
+
+	data.Filter([]string{"kubernetesVersion", "cni-plugin", "not-collected"})
+
+	if want := map[string]string{"kubernetesVersion": "v1.30.0", "reportId": "id"}; !reflect.DeepEqual(data.ExtraTagInfo, want) {
+		t.Errorf("ExtraTagInfo = %v, want %v", data.ExtraTagInfo, want)
+	}
+	if want := map[string]interface{}{"cni-plugin": "canal"}; !reflect.DeepEqual(data.ExtraFieldInfo, want) {
+		t.Errorf("ExtraFieldInfo = %v, want %v", data.ExtraFieldInfo, want)
+	}
+	if data.AppVersion != "v1.30.0" {
+		t.Errorf("AppVersion = %q, want it kept", data.AppVersion)
+	}
+}
+
+func TestDataAddTags(t *testing.T) {
+	data := &Data{ExtraTagInfo: map[string]string{"clusteruuid": "uuid", "reportId": "id"}}
+
+	data.AddTags(map[string]string{"environment": "prod", "clusteruuid": "explicit"})
+
+	want := map[string]string{"clusteruuid": "explicit", "environment": "prod", "reportId": "id"}
+	if !reflect.DeepEqual(data.ExtraTagInfo, want) {
+		t.Errorf("ExtraTagInfo = %v, want %v", data.ExtraTagInfo, want)
 	}
+}
 
-	if data.ExtraFieldInfo["rancher-managed"] != true {
-		t.Errorf("rancher-managed = %v, want true", data.ExtraFieldInfo["rancher-managed"])
+func TestDataRenameFields(t *testing.T) {
+	data := &Data{
+		ExtraTagInfo:   map[string]string{"clusteruuid": "uuid", "kubernetesVersion": "v1.30.0", "reportId": "id"},
+		ExtraFieldInfo: map[string]interface{}{"serverNodeCount": 3, "agentNodeCount": 2, "os": "linux"},
 	}
-	if data.ExtraFieldInfo["rancher-version"] != "v2.8.0" {
-		t.Errorf("rancher-version = %v, want v2.8.0", data.ExtraFieldInfo["rancher-version"])
+
+	data.RenameFields(map[string]string{
+		"kubernetesVersion": "kubernetes_version",
+		"reportId":          "report_id",
+		"serverNodeCount":   "server_node_count",
+		"agentNodeCount":    "os", // replaces the collected os
+		"not-collected":     "not_collected",
+	})
+
+	if want := map[string]string{"clusteruuid": "uuid", "kubernetes_version": "v1.30.0", "reportId": "id"}; !reflect.DeepEqual(data.ExtraTagInfo, want) {
+		t.Errorf("ExtraTagInfo = %v, want %v", data.ExtraTagInfo, want)
 	}
-	if data.ExtraFieldInfo["rancher-install-uuid"] != "rancher-install-uuid-123" {
-		t.Errorf("rancher-install-uuid = %v, want rancher-install-uuid-123", data.ExtraFieldInfo["rancher-install-uuid"])
+	if want := map[string]interface{}{"server_node_count": 3, "os": 2}; !reflect.DeepEqual(data.ExtraFieldInfo, want) {
+		t.Errorf("ExtraFieldInfo = %v, want %v", data.ExtraFieldInfo, want)
 	}
 }
 
-func TestCollect_MissingKubeSystem(t *testing.T) {
-	clientset := fake.NewClientset()
+func TestDataDigest(t *testing.T) {
+	data := func(reportID, timestamp string, nodes int) *Data {
+		return &Data{
+			SchemaVersion:  SchemaVersion,
+			AppVersion:     "v1.32.2+rke2r1",
+			ExtraTagInfo:   map[string]string{"clusteruuid": "uuid", reportIDKey: reportID},
+			ExtraFieldInfo: map[string]interface{}{"timestamp": timestamp, "collectionDurationMs": int64(12), "serverNodeCount": nodes},
+		}
+	}
+	digest := func(d *Data) string {
+		t.Helper()
+		got, err := d.Digest()
+		if err != nil {
+			t.Fatalf("Digest() error = %v", err)
+		}
+		return got
+	}
 
-	_, err := Collect(context.Background(), clientset, "recommended")
-	if err == nil {
-		t.Error("Collect() expected error for missing kube-system namespace")
+	first := digest(data("report-1", "2025-01-15T08:00:00Z", 3))
+	if got := digest(data("report-2", "2025-01-15T09:00:00Z", 3)); got != first {
+		t.Errorf("Digest() changed with only volatile fields: %s, want %s", got, first)
+	}
+	if got := digest(data("report-1", "2025-01-15T08:00:00Z", 4)); got == first {
+		t.Error("Digest() unchanged after serverNodeCount changed")
 	}
 }
 
@@ -390,7 +1136,7 @@ func TestSend_Success(t *testing.T) {
 		ExtraFieldInfo: map[string]interface{}{"serverNodeCount": 1},
 	}
 
-	resp, err := Send(context.Background(), data, server.URL)
+	resp, err := Send(context.Background(), data, server.URL, SendOptions{})
 	if err != nil {
 		t.Fatalf("Send() error = %v", err)
 	}
@@ -405,6 +1151,305 @@ func TestSend_Success(t *testing.T) {
 	}
 }
 
+func TestSendAll(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	tests := []struct {
+		name       string
+		endpoints  []string
+		requireAll bool
+		wantErr    bool
+	}{
+		{"all succeed", []string{ok.URL, ok.URL}, true, false},
+		{"one succeeds", []string{failing.URL, ok.URL}, false, false},
+		{"one fails with require all", []string{ok.URL, failing.URL}, true, true},
+		{"all fail", []string{failing.URL, failing.URL}, false, true},
+	}
+
+	data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SendAll(context.Background(), data, tt.endpoints, SendOptions{}, tt.requireAll)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SendAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailureStreaks(t *testing.T) {
+	var down atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer flaky.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	streaks := NewFailureStreaks()
+	opts := SendOptions{Streaks: streaks}
+	data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+	endpoints := []string{flaky.URL, failing.URL}
+
+	// Each step is one cycle; the delay grows only while every endpoint fails.
+	steps := []struct {
+		down      bool
+		wantDelay time.Duration
+	}{
+		{false, time.Minute},
+		{true, 2 * time.Minute},
+		{true, 4 * time.Minute},
+		{true, 5 * time.Minute},
+		{false, time.Minute},
+	}
+	for i, step := range steps {
+		down.Store(step.down)
+		_ = SendAll(context.Background(), data, endpoints, opts, false)
+		if got := streaks.Delay(time.Minute, 5*time.Minute); got != step.wantDelay {
+			t.Errorf("cycle %d: Delay() = %v, want %v", i, got, step.wantDelay)
+		}
+	}
+	if got := streaks.streaks[failing.URL]; got != len(steps) {
+		t.Errorf("failing endpoint streak = %d, want %d", got, len(steps))
+	}
+
+	var none *FailureStreaks
+	if got := none.Delay(time.Minute, 5*time.Minute); got != time.Minute {
+		t.Errorf("nil Delay() = %v, want base", got)
+	}
+}
+
+func TestSend_UserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"default", "", "rke2-security-responder"},
+		{"versioned", "rke2-security-responder/v1.2.3", "rke2-security-responder/v1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("User-Agent")
+				_ = json.NewEncoder(w).Encode(Response{})
+			}))
+			defer server.Close()
+
+			data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+			if _, err := Send(context.Background(), data, server.URL, SendOptions{UserAgent: tt.userAgent}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSend_SchemaVersion(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+	collected, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		schemaVersion string
+		wantHeader    string
+	}{
+		{"collected", collected.SchemaVersion, SchemaVersion},
+		{"overridden", "2", "2"},
+		{"unset", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header string
+			var body Data
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Get("X-Schema-Version")
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				_ = json.NewEncoder(w).Encode(Response{})
+			}))
+			defer server.Close()
+
+			data := &Data{SchemaVersion: tt.schemaVersion, ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+			if _, err := Send(context.Background(), data, server.URL, SendOptions{}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if header != tt.wantHeader || body.SchemaVersion != tt.wantHeader {
+				t.Errorf("X-Schema-Version = %q, schemaVersion = %q; want %q", header, body.SchemaVersion, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestSend_Method(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		clusterUUID string
+		wantMethod  string
+		wantPath    string
+		wantErr     bool
+	}{
+		{"default", "", "/v1/check", "uuid", http.MethodPost, "/v1/check", false},
+		{"put", http.MethodPut, "/v1/check", "uuid", http.MethodPut, "/v1/check", false},
+		{"cluster UUID in path", http.MethodPut, "/v1/clusters/{clusterUUID}", "a/b", http.MethodPut, "/v1/clusters/a%2Fb", false},
+		{"missing cluster UUID", http.MethodPut, "/v1/clusters/{clusterUUID}", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotMethod, gotPath string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotMethod, gotPath = r.Method, r.URL.EscapedPath()
+				_ = json.NewEncoder(w).Encode(Response{})
+			}))
+			defer server.Close()
+
+			data := &Data{ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+			if tt.clusterUUID != "" {
+				data.ExtraTagInfo["clusteruuid"] = tt.clusterUUID
+			}
+			_, err := Send(context.Background(), data, server.URL+tt.path, SendOptions{Method: tt.method})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotMethod != tt.wantMethod || gotPath != tt.wantPath {
+				t.Errorf("request = %s %s, want %s %s", gotMethod, gotPath, tt.wantMethod, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestSend_Compressed(t *testing.T) {
+	var bodies atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Content-Encoding = %q, want gzip", r.Header.Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var got Data
+		if err := json.NewDecoder(zr).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if got.AppVersion != "v1.30.0" {
+			t.Errorf("appVersion = %q, want v1.30.0", got.AppVersion)
+		}
+		// Fail the first attempt to check the compressed body is replayed intact.
+		if bodies.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer server.Close()
+
+	data := &Data{AppVersion: "v1.30.0", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	_, err := Send(context.Background(), data, server.URL, SendOptions{MaxRetries: 1, RetryDelay: time.Millisecond, Compress: true})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if bodies.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", bodies.Load())
+	}
+}
+
+func TestSend_AuthToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantAuthz string
+	}{
+		{"no token", "", ""},
+		{"token", "s3cr3t", "Bearer s3cr3t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != tt.wantAuthz {
+					t.Errorf("Authorization = %q, want %q", got, tt.wantAuthz)
+				}
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(Response{})
+			}))
+			defer server.Close()
+
+			data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+			if _, err := Send(context.Background(), data, server.URL, SendOptions{AuthToken: tt.token}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSend_HMACSignature(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		compress bool
+	}{
+		{"unsigned", "", false},
+		{"signed", "k3y", false},
+		{"signed compressed", "k3y", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("read body: %v", err)
+				}
+				want := ""
+				if tt.key != "" {
+					mac := hmac.New(sha256.New, []byte(tt.key))
+					mac.Write(body)
+					want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+				}
+				if got := r.Header.Get("X-Signature"); got != want {
+					t.Errorf("X-Signature = %q, want %q", got, want)
+				}
+				_ = json.NewEncoder(w).Encode(Response{})
+			}))
+			defer server.Close()
+
+			data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+			if _, err := Send(context.Background(), data, server.URL, SendOptions{HMACKey: tt.key, Compress: tt.compress}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+		})
+	}
+}
+
 func TestSend_RetryOnError(t *testing.T) {
 	var attempts atomic.Int32
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -420,7 +1465,9 @@ func TestSend_RetryOnError(t *testing.T) {
 
 	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
 
-	_, err := Send(context.Background(), data, server.URL)
+	opts := DefaultSendOptions()
+	opts.RetryDelay = time.Millisecond
+	_, err := Send(context.Background(), data, server.URL, opts)
 	if err != nil {
 		t.Fatalf("Send() error = %v", err)
 	}
@@ -429,6 +1476,50 @@ func TestSend_RetryOnError(t *testing.T) {
 	}
 }
 
+func TestSend_IdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("X-Idempotency-Key"))
+		attempt := len(keys)
+		mu.Unlock()
+		if attempt < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer server.Close()
+
+	clientset := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uuid"}})
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	reportID := data.ExtraTagInfo["reportId"]
+	if _, err := uuid.Parse(reportID); err != nil {
+		t.Fatalf("reportId = %q, want a UUID: %v", reportID, err)
+	}
+	again, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if again.ExtraTagInfo["reportId"] == reportID {
+		t.Errorf("reportId %q reused across collections", reportID)
+	}
+
+	opts := DefaultSendOptions()
+	opts.RetryDelay = time.Millisecond
+	if _, err := Send(context.Background(), data, server.URL, opts); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	want := []string{reportID, reportID, reportID}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("X-Idempotency-Key per attempt = %v, want %v", keys, want)
+	}
+}
+
 func TestSend_AllRetriesFail(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -437,12 +1528,110 @@ func TestSend_AllRetriesFail(t *testing.T) {
 
 	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
 
-	_, err := Send(context.Background(), data, server.URL)
+	opts := DefaultSendOptions()
+	opts.RetryDelay = time.Millisecond
+	_, err := Send(context.Background(), data, server.URL, opts)
 	if err == nil {
 		t.Error("Send() expected error after all retries fail")
 	}
 }
 
+func TestSend_RetryCount(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		wantAttempts int32
+	}{
+		{"no retries", 0, 1},
+		{"one retry", 1, 2},
+		{"default", DefaultMaxRetries, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+			_, err := Send(context.Background(), data, server.URL, SendOptions{MaxRetries: tt.maxRetries, RetryDelay: time.Millisecond})
+			if err == nil {
+				t.Error("Send() expected error")
+			}
+			if attempts.Load() != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestSend_RetryableStatus(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantAttempts int32
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusUnauthorized, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusRequestTimeout, 3},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusInternalServerError, 3},
+		{http.StatusBadGateway, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+			_, err := Send(context.Background(), data, server.URL, SendOptions{MaxRetries: 2, RetryDelay: time.Millisecond})
+			if err == nil {
+				t.Error("Send() expected error")
+			}
+			if attempts.Load() != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestResponseSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		secrets []string
+		want    string
+	}{
+		{"plain", `{"error":"unknown field clusteruuid"}`, nil, `{"error":"unknown field clusteruuid"}`},
+		{"bearer", "invalid credentials: Bearer abc.def-123", nil, "invalid credentials: Bearer [REDACTED]"},
+		{"jwt", "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln expired", nil, "token [REDACTED] expired"},
+		{"json key", `{"error":"denied","api_key":"k-123","detail":"x"}`, nil, `{"error":"denied","api_key":"[REDACTED]","detail":"x"}`},
+		{"query key", "rejected /v1/check?token=s3cret&x=1", nil, "rejected /v1/check?token=[REDACTED]&x=1"},
+		{"configured secret", "bad signature for key hunter2", []string{"", "hunter2"}, "bad signature for key [REDACTED]"},
+		{"truncated", strings.Repeat("a", 600), nil, strings.Repeat("a", 512) + "...(truncated)"},
+		{"truncated mid rune", strings.Repeat("a", 511) + "é", nil, strings.Repeat("a", 511) + "...(truncated)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseSnippet([]byte(tt.body), tt.secrets...); got != tt.want {
+				t.Errorf("responseSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSend_MalformedResponse(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -452,7 +1641,7 @@ func TestSend_MalformedResponse(t *testing.T) {
 
 	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
 
-	resp, err := Send(context.Background(), data, server.URL)
+	resp, err := Send(context.Background(), data, server.URL, SendOptions{})
 	if err != nil {
 		t.Errorf("Send() error = %v, want nil (graceful degradation)", err)
 	}
@@ -481,7 +1670,7 @@ func TestCollect_GPUOperatorDetection(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -510,7 +1699,7 @@ func TestCollect_IngressAsDaemonSet(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -549,7 +1738,7 @@ func TestCollect_IPStackFromService(t *testing.T) {
 				},
 			)
 
-			data, err := Collect(context.Background(), clientset, "recommended")
+			data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 			if err != nil {
 				t.Fatalf("Collect() error = %v", err)
 			}
@@ -570,7 +1759,7 @@ func TestCollect_IPStackNoService(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -624,7 +1813,7 @@ func TestCollect_MinimalMode(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "minimal")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "minimal"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -715,7 +1904,7 @@ func TestCollect_RecommendedModeIncludesRancherDetails(t *testing.T) {
 		},
 	)
 
-	data, err := Collect(context.Background(), clientset, "recommended")
+	data, err := Collect(context.Background(), clientset, CollectOptions{Mode: "recommended"})
 	if err != nil {
 		t.Fatalf("Collect() error = %v", err)
 	}
@@ -744,3 +1933,109 @@ func TestCollect_RecommendedModeIncludesRancherDetails(t *testing.T) {
 		t.Errorf("rancher-install-uuid = %v, want test-uuid", data.ExtraFieldInfo["rancher-install-uuid"])
 	}
 }
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    int
+		base     time.Duration
+		maxDelay time.Duration
+		ceiling  time.Duration
+	}{
+		{"first retry", 1, time.Second, 30 * time.Second, time.Second},
+		{"second retry doubles", 2, time.Second, 30 * time.Second, 2 * time.Second},
+		{"third retry doubles again", 3, time.Second, 30 * time.Second, 4 * time.Second},
+		{"capped", 10, time.Second, 30 * time.Second, 30 * time.Second},
+		{"uncapped", 6, time.Second, 0, 32 * time.Second},
+		{"zero base", 3, 0, 30 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := backoffDelay(tt.retry, tt.base, tt.maxDelay)
+				if got < 0 || got > tt.ceiling {
+					t.Fatalf("backoffDelay() = %v, want within [0, %v]", got, tt.ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestSend_ContextCancelledDuringBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	start := time.Now()
+	_, err := Send(ctx, data, server.URL, SendOptions{MaxRetries: 5, RetryDelay: time.Minute, MaxRetryDelay: time.Minute})
+	if err == nil {
+		t.Error("Send() expected error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() took %v, want prompt return on context cancellation", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero seconds", "0", 0, true},
+		{"negative seconds", "-5", 0, false},
+		{"seconds capped", "86400", maxRetryAfter, true},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"http date in past", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"http date capped", now.Add(time.Hour).Format(http.TimeFormat), maxRetryAfter, true},
+		{"garbage", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.header, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSend_HonorsRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Response{})
+	}))
+	defer server.Close()
+
+	data := &Data{AppVersion: "test", ExtraTagInfo: map[string]string{}, ExtraFieldInfo: map[string]interface{}{}}
+
+	// A base delay of one minute would exceed the timeout unless Retry-After wins.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Send(ctx, data, server.URL, SendOptions{MaxRetries: 1, RetryDelay: time.Minute})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", attempts.Load())
+	}
+}
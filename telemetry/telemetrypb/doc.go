@@ -0,0 +1,10 @@
+// Package telemetrypb holds the Go stubs generated from telemetry.proto, the
+// contract of the grpc payload format.
+//
+// After editing telemetry.proto, regenerate them with protoc and the pinned
+// plugins (protoc-gen-go v1.36.8, protoc-gen-go-grpc v1.5.1):
+//
+//	make generate
+package telemetrypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative telemetry.proto